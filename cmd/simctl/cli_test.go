@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLI runs simctl against server with stdin as its standard input and
+// returns the exit code and captured output.
+func runCLI(t *testing.T, server, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	return runCLIContext(context.Background(), t, server, stdin, args...)
+}
+
+// runCLIContext is runCLI with a caller-controlled context, standing in for
+// Ctrl-C.
+func runCLIContext(ctx context.Context, t *testing.T, server, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	for _, k := range []string{"SIMCTL_SERVER", "SIMCTL_TIMEOUT", "SIMCTL_PROFILE", "SIMCTL_TOKEN", "SIMCTL_NAMESPACE"} {
+		t.Setenv(k, "")
+	}
+	// Tests that exercise profiles point SIMCTL_CONFIG at their own file.
+	if os.Getenv("SIMCTL_CONFIG") == "" {
+		t.Setenv("SIMCTL_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	}
+	var out, errOut bytes.Buffer
+	args = append([]string{"--server", server}, args...)
+	code = run(ctx, args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// writeJSONResponse is the test servers' equivalent of gin's c.JSON.
+func writeJSONResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,260 @@
+// client.go
+// HTTP client shared by all subcommands: request IDs, timeouts and
+// decoding of the server's error envelope.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxErrorBody bounds how much of a non-JSON error body is echoed back.
+const maxErrorBody = 512
+
+type client struct {
+	base      *url.URL
+	http      *http.Client
+	timeout   time.Duration
+	token     string
+	namespace string
+}
+
+// client builds an API client from the global settings.
+func (e *env) client() (*client, error) {
+	if err := e.settle(); err != nil {
+		return nil, err
+	}
+	if err := checkServerURL(e.server); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(strings.TrimRight(e.server, "/"))
+	if e.timeout <= 0 {
+		return nil, usagef("--timeout must be positive, got %s", e.timeout)
+	}
+	return &client{
+		base: u,
+		http: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: e.timeout,
+			IdleConnTimeout:       90 * time.Second,
+		}},
+		timeout:   e.timeout,
+		token:     e.token,
+		namespace: e.namespace,
+	}, nil
+}
+
+// apiError is a non-2xx response decoded from the server's error envelope.
+type apiError struct {
+	Status    int
+	Code      string
+	Message   string
+	RequestID string
+	Details   []fieldError
+}
+
+// fieldError is one per-field violation from a validation failure.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "server returned %d %s", e.Status, http.StatusText(e.Status))
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	if e.Code != "" {
+		b.WriteString(" (" + e.Code + ")")
+	}
+	if e.RequestID != "" {
+		b.WriteString(" [request " + e.RequestID + "]")
+	}
+	return b.String()
+}
+
+// transportError means the server could not be reached or the exchange
+// broke off before a complete response arrived.
+type transportError struct {
+	Op  string
+	Err error
+}
+
+func (e *transportError) Error() string { return e.Op + ": " + e.Err.Error() }
+func (e *transportError) Unwrap() error { return e.Err }
+
+// request describes one API call. Path is relative to the server URL.
+type request struct {
+	Method      string
+	Path        string
+	Query       url.Values
+	Body        io.Reader
+	ContentType string
+	Header      http.Header
+}
+
+// send performs req and returns the response with its body open when the
+// status is 2xx; any other status is decoded into an *apiError. The caller
+// controls the deadline through ctx, which suits streaming responses.
+func (c *client) send(ctx context.Context, req request) (*http.Response, error) {
+	u := *c.base
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + strings.TrimLeft(req.Path, "/")
+	if len(req.Query) > 0 {
+		u.RawQuery = req.Query.Encode()
+	}
+	hr, err := http.NewRequestWithContext(ctx, req.Method, u.String(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range req.Header {
+		hr.Header[k] = vs
+	}
+	if req.ContentType != "" {
+		hr.Header.Set("Content-Type", req.ContentType)
+	}
+	if hr.Header.Get("Accept") == "" {
+		hr.Header.Set("Accept", "application/json")
+	}
+	hr.Header.Set("User-Agent", "simctl/"+version)
+	if c.token != "" {
+		hr.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.namespace != "" {
+		hr.Header.Set("X-Namespace", c.namespace)
+	}
+	reqID := newRequestID()
+	hr.Header.Set("X-Request-ID", reqID)
+
+	resp, err := c.http.Do(hr)
+	if err != nil {
+		return nil, &transportError{Op: req.Method + " " + u.Path, Err: err}
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, decodeAPIError(resp, reqID)
+}
+
+// getJSON issues a GET and decodes the JSON response into out.
+func (c *client) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	return c.doJSON(ctx, request{Method: http.MethodGet, Path: path, Query: query}, out)
+}
+
+// postJSON issues a POST with in as the body and decodes the response into
+// out. A []byte in is sent verbatim so parameter files pass through as-is.
+func (c *client) postJSON(ctx context.Context, path string, query url.Values, in, out any) error {
+	var body []byte
+	switch v := in.(type) {
+	case nil:
+	case []byte:
+		body = v
+	default:
+		var err error
+		if body, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	return c.doJSON(ctx, request{
+		Method:      http.MethodPost,
+		Path:        path,
+		Query:       query,
+		Body:        bytes.NewReader(body),
+		ContentType: "application/json",
+	}, out)
+}
+
+// doJSON runs req under the client timeout and decodes a JSON response.
+func (c *client) doJSON(ctx context.Context, req request, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return wrapRead(req, err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var se *json.SyntaxError
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &se) || errors.As(err, &te) {
+			return fmt.Errorf("%s %s: decoding response: %w", req.Method, req.Path, err)
+		}
+		return wrapRead(req, err)
+	}
+	return nil
+}
+
+func wrapRead(req request, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transportError{Op: "reading " + req.Method + " " + req.Path, Err: err}
+}
+
+// decodeAPIError turns an error response into an *apiError. The server
+// replies with {"error": {...}} envelopes, but older builds send
+// {"error": "message"}, and proxies in front of it send plain text; all
+// three are accepted.
+func decodeAPIError(resp *http.Response, reqID string) error {
+	ae := &apiError{Status: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+	if ae.RequestID == "" {
+		ae.RequestID = reqID
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	type envelope struct {
+		Code      string       `json:"code"`
+		Message   string       `json:"message"`
+		RequestID string       `json:"request_id"`
+		Details   []fieldError `json:"details"`
+	}
+	var outer struct {
+		Error json.RawMessage `json:"error"`
+		envelope
+	}
+	if err := json.Unmarshal(raw, &outer); err != nil {
+		ae.Message = strings.TrimSpace(string(raw[:min(len(raw), maxErrorBody)]))
+		return ae
+	}
+	inner := outer.envelope
+	if len(outer.Error) > 0 {
+		var s string
+		if json.Unmarshal(outer.Error, &s) == nil {
+			inner.Message = s
+		} else {
+			_ = json.Unmarshal(outer.Error, &inner)
+		}
+	}
+	ae.Code, ae.Message, ae.Details = inner.Code, inner.Message, inner.Details
+	if inner.RequestID != "" {
+		ae.RequestID = inner.RequestID
+	}
+	return ae
+}
+
+// newRequestID returns a random 128-bit hex ID for X-Request-ID.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("simctl-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
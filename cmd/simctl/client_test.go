@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string // X-Request-ID sent by the server
+		body   string
+		want   apiError
+	}{
+		{
+			name: "envelope",
+			body: `{"error":{"code":"validation_failed","message":"invalid parameters","request_id":"srv-1",` +
+				`"details":[{"field":"/dt","message":"must be > 0"}]}}`,
+			want: apiError{Status: 422, Code: "validation_failed", Message: "invalid parameters", RequestID: "srv-1",
+				Details: []fieldError{{Field: "/dt", Message: "must be > 0"}}},
+		},
+		{
+			name:   "string error",
+			header: "hdr-1",
+			body:   `{"error":"grid_size must be positive"}`,
+			want:   apiError{Status: 422, Message: "grid_size must be positive", RequestID: "hdr-1"},
+		},
+		{
+			name: "plain text",
+			body: "502 Bad Gateway\n",
+			want: apiError{Status: 422, Message: "502 Bad Gateway", RequestID: "client-1"},
+		},
+		{
+			name: "long plain text is cut",
+			body: strings.Repeat("x", 2*maxErrorBody),
+			want: apiError{Status: 422, Message: strings.Repeat("x", maxErrorBody), RequestID: "client-1"},
+		},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: 422, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tt.body))}
+		if tt.header != "" {
+			resp.Header.Set("X-Request-ID", tt.header)
+		}
+		got, ok := decodeAPIError(resp, "client-1").(*apiError)
+		if !ok || !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: decodeAPIError = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientSendsRequestIDAndDecodes(t *testing.T) {
+	var gotID, gotUA string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID, gotUA = r.Header.Get("X-Request-ID"), r.Header.Get("User-Agent")
+		writeJSONResponse(w, http.StatusOK, map[string]string{"version": "v1"})
+	}))
+	defer srv.Close()
+
+	c, err := (&env{server: srv.URL + "/", timeout: defaultTimeout}).client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out buildInfo
+	if err := c.getJSON(context.Background(), "/api/version", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Version != "v1" {
+		t.Errorf("decoded %+v", out)
+	}
+	if len(gotID) != 32 {
+		t.Errorf("X-Request-ID = %q, want a 128-bit hex ID", gotID)
+	}
+	if !strings.HasPrefix(gotUA, "simctl/") {
+		t.Errorf("User-Agent = %q", gotUA)
+	}
+}
+
+func TestClientTransportError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	code, _, stderr := runCLI(t, "http://"+addr, "", "--json", "version")
+	if code != exitTransport {
+		t.Fatalf("exit %d, want %d", code, exitTransport)
+	}
+	var report struct {
+		Error struct {
+			ExitCode int `json:"exit_code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(stderr), &report); err != nil || report.Error.ExitCode != exitTransport {
+		t.Errorf("--json error report %q (%v)", stderr, err)
+	}
+}
+
+func TestClientRejectsBadServerURL(t *testing.T) {
+	for _, u := range []string{"localhost:8080", "ftp://host", "http://"} {
+		if _, err := (&env{server: u, timeout: defaultTimeout}).client(); exitCode(err) != exitUsage {
+			t.Errorf("client(%q): err %v, want a usage error", u, err)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// completion.go
+// simctl completion bash|zsh|fish, and the hidden __complete command the
+// generated scripts call to list candidates for the word being typed.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Remote names are looked up with a short deadline so completion never
+// hangs offline, and cached briefly so repeated tabs stay instant.
+const (
+	completionTimeout  = time.Second
+	completionCacheTTL = 30 * time.Second
+)
+
+var completionCmd = &command{
+	name:    "completion",
+	summary: "print a shell completion script",
+	run:     runCompletion,
+	examples: []example{
+		{"bash: load completion in the current shell", "source <(simctl completion bash)"},
+		{"zsh: install for every new shell", `simctl completion zsh > "${fpath[1]}/_simctl"`},
+		{"fish", "simctl completion fish > ~/.config/fish/completions/simctl.fish"},
+	},
+}
+
+var completeCmd = &command{
+	name:   "__complete",
+	hidden: true,
+	run:    runComplete,
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for simctl
+_simctl() {
+    local IFS=$'\n'
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local words
+    words=$(simctl __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1)
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -o default -F _simctl simctl
+`,
+	"zsh": `#compdef simctl
+# zsh completion for simctl
+_simctl() {
+    local -a lines comps
+    local line
+    lines=("${(@f)$(simctl __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    for line in $lines; do
+        [[ -z $line ]] && continue
+        comps+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+    done
+    if (( ${#comps} )); then
+        _describe simctl comps
+    else
+        _files
+    fi
+}
+compdef _simctl simctl
+`,
+	"fish": `# fish completion for simctl
+function __simctl_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    simctl __complete -- $tokens[2..-1] 2>/dev/null
+end
+complete -c simctl -a '(__simctl_complete)'
+`,
+}
+
+func runCompletion(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl completion bash|zsh|fish")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("completion takes exactly one shell: bash, zsh or fish")
+	}
+	script, ok := completionScripts[rest[0]]
+	if !ok {
+		return usagef("unsupported shell %q: want bash, zsh or fish", rest[0])
+	}
+	_, err = io.WriteString(e.stdout, script)
+	return err
+}
+
+// remoteArgs names the remote objects a command's positional arguments
+// complete to.
+var remoteArgs = map[string]string{
+	"results get":      "results",
+	"results download": "results",
+	"results delete":   "results",
+	"diff":             "results",
+	"watch job":        "jobs",
+}
+
+// candidate is one completion: the word and a description for shells that
+// show them.
+type candidate struct {
+	value string
+	desc  string
+}
+
+func runComplete(ctx context.Context, e *env, args []string) error {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for _, c := range e.complete(ctx, args[:len(args)-1], args[len(args)-1]) {
+		fmt.Fprintf(e.stdout, "%s\t%s\n", c.value, c.desc)
+	}
+	return nil
+}
+
+// complete lists candidates for cur given the words before it. Errors of
+// any kind just mean fewer candidates: the shell falls back to files.
+func (e *env) complete(ctx context.Context, prev []string, cur string) []candidate {
+	table := commands
+	var (
+		path  []string
+		leaf  *command
+		fs    = rootFlagSet()
+		nargs int
+	)
+	for i := 0; i < len(prev); i++ {
+		w := prev[i]
+		if strings.HasPrefix(w, "-") && w != "-" {
+			name, value, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+			f := fs.Lookup(name)
+			if f == nil || isBoolFlag(f) || hasValue {
+				e.noteFlag(name, value)
+				continue
+			}
+			if i+1 == len(prev) {
+				return filterPrefix(flagValueCandidates(name), cur)
+			}
+			i++
+			e.noteFlag(name, prev[i])
+			continue
+		}
+		if leaf != nil {
+			nargs++
+			continue
+		}
+		var next *command
+		for _, c := range table {
+			if c.name == w && !c.hidden {
+				next = c
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		path = append(path, w)
+		if len(next.children) > 0 {
+			table = next.children
+			continue
+		}
+		leaf = next
+		if fs = commandFlags(leaf); fs == nil {
+			fs = rootFlagSet()
+		}
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		var out []candidate
+		fs.VisitAll(func(f *flag.Flag) {
+			out = append(out, candidate{"--" + f.Name, f.Usage})
+		})
+		return filterPrefix(out, cur)
+	}
+	if leaf == nil {
+		var out []candidate
+		for _, c := range table {
+			if !c.hidden {
+				out = append(out, candidate{c.name, c.summary})
+			}
+		}
+		return filterPrefix(out, cur)
+	}
+	return filterPrefix(e.argCandidates(ctx, strings.Join(path, " "), nargs), cur)
+}
+
+// noteFlag applies connection flags seen on the command line, so remote
+// names come from the server and profile being typed against.
+func (e *env) noteFlag(name, value string) {
+	switch name {
+	case "server":
+		e.server = value
+	case "profile":
+		e.profile = value
+	case "namespace":
+		e.namespace = value
+	}
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// flagValueCandidates lists the values of flags with a fixed or local set
+// of choices; anything else, usually a path, is left to the shell.
+func flagValueCandidates(name string) []candidate {
+	var out []candidate
+	switch name {
+	case "output":
+		for _, f := range outputFormats {
+			out = append(out, candidate{f, "output format"})
+		}
+	case "type":
+		for _, t := range simTypes {
+			out = append(out, candidate{t, "simulation type"})
+		}
+	case "profile":
+		out = profileCandidates()
+	}
+	return out
+}
+
+func profileCandidates() []candidate {
+	path, err := configPath()
+	if err != nil {
+		return nil
+	}
+	cfg, err := loadConfig(path, io.Discard)
+	if err != nil {
+		return nil
+	}
+	var out []candidate
+	for _, name := range cfg.names() {
+		out = append(out, candidate{name, "profile " + cfg.Profiles[name].Server})
+	}
+	return out
+}
+
+// argCandidates lists values for the nargs'th positional argument of the
+// command at path.
+func (e *env) argCandidates(ctx context.Context, path string, nargs int) []candidate {
+	switch path {
+	case "completion":
+		if nargs == 0 {
+			return []candidate{{"bash", "shell"}, {"zsh", "shell"}, {"fish", "shell"}}
+		}
+	case "config use":
+		if nargs == 0 {
+			return profileCandidates()
+		}
+	case "config get", "config set":
+		if nargs == 0 {
+			var out []candidate
+			for _, k := range profileKeys {
+				out = append(out, candidate{k, "profile setting"})
+			}
+			return out
+		}
+	}
+	kind, ok := remoteArgs[path]
+	if !ok {
+		return nil
+	}
+	var out []candidate
+	for _, name := range e.remoteNames(ctx, kind) {
+		out = append(out, candidate{name, strings.TrimSuffix(kind, "s")})
+	}
+	return out
+}
+
+// remoteNames returns result filenames or job IDs from the server, using a
+// cache entry younger than completionCacheTTL when there is one.
+func (e *env) remoteNames(ctx context.Context, kind string) []string {
+	if err := e.settle(); err != nil {
+		return nil
+	}
+	cache := completionCachePath(e.server + "\x00" + e.namespace + "\x00" + kind)
+	if cache != "" {
+		if fi, err := os.Stat(cache); err == nil && time.Since(fi.ModTime()) < completionCacheTTL {
+			var names []string
+			if b, err := os.ReadFile(cache); err == nil && json.Unmarshal(b, &names) == nil {
+				return names
+			}
+		}
+	}
+
+	e.timeout = min(e.timeout, completionTimeout)
+	c, err := e.client()
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	var names []string
+	switch kind {
+	case "results":
+		entries, err := listResults(ctx, c, nil)
+		if err != nil {
+			return nil
+		}
+		for _, r := range entries {
+			names = append(names, r.Filename)
+		}
+	case "jobs":
+		jobs, err := listJobs(ctx, c)
+		if err != nil {
+			return nil
+		}
+		for _, j := range jobs {
+			names = append(names, j.ID)
+		}
+	}
+
+	if cache != "" {
+		if b, err := json.Marshal(names); err == nil && os.MkdirAll(filepath.Dir(cache), 0o700) == nil {
+			os.WriteFile(cache, b, 0o600)
+		}
+	}
+	return names
+}
+
+// completionCachePath is the cache file for key under the user cache
+// directory, or "" when there is none.
+func completionCachePath(key string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, "simctl", "complete-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+func filterPrefix(cands []candidate, prefix string) []candidate {
+	var out []candidate
+	for _, c := range cands {
+		if strings.HasPrefix(c.value, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// complete runs simctl __complete with words and returns the candidate
+// values, one per line.
+func complete(t *testing.T, server string, words ...string) []string {
+	t.Helper()
+	code, out, errOut := runCLI(t, server, "", append([]string{"__complete", "--"}, words...)...)
+	if code != 0 {
+		t.Fatalf("__complete %q: exit %d: %s", words, code, errOut)
+	}
+	var values []string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		value, _, ok := strings.Cut(line, "\t")
+		if !ok {
+			t.Fatalf("__complete %q: line %q has no description", words, line)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestCompleteLocal(t *testing.T) {
+	writeTestConfig(t, testConfig, 0o600)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	const offline = "http://127.0.0.1:1"
+	for _, tc := range []struct {
+		words []string
+		want  string
+	}{
+		{[]string{""}, "simulate optimize sweep results diff watch config completion version"},
+		{[]string{"re"}, "results"},
+		{[]string{"results", "d"}, "download delete"},
+		{[]string{"results", "list", "--ty"}, "--type"},
+		{[]string{"results", "list", "--type", ""}, "heat nbody"},
+		{[]string{"--output", "j"}, "json"},
+		{[]string{"watch", "queue", "--once", "--int"}, "--interval"},
+		{[]string{"--profile", ""}, "dev prod"},
+		{[]string{"config", "use", "p"}, "prod"},
+		{[]string{"config", "get", "na"}, "namespace"},
+		{[]string{"completion", ""}, "bash zsh fish"},
+		{[]string{"nosuch", ""}, ""},
+	} {
+		if got := strings.Join(complete(t, offline, tc.words...), " "); got != tc.want {
+			t.Errorf("complete %q = %q, want %q", tc.words, got, tc.want)
+		}
+	}
+}
+
+func TestCompleteRemoteNames(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/results" {
+			http.NotFound(w, r)
+			return
+		}
+		hits.Add(1)
+		writeJSONResponse(w, http.StatusOK, []resultEntry{{Filename: "heat_1.json"}, {Filename: "heat_2.json"}, {Filename: "nbody_1.json"}})
+	}))
+	defer srv.Close()
+
+	if got := strings.Join(complete(t, srv.URL, "results", "download", "heat"), " "); got != "heat_1.json heat_2.json" {
+		t.Errorf("first completion = %q", got)
+	}
+	// The second tab is served from the cache.
+	if got := strings.Join(complete(t, srv.URL, "results", "delete", "n"), " "); got != "nbody_1.json" {
+		t.Errorf("cached completion = %q", got)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("server hit %d times, want 1", n)
+	}
+
+	// Once the entry is older than the TTL, the server is asked again.
+	key := srv.URL + "\x00\x00results"
+	old := time.Now().Add(-2 * completionCacheTTL)
+	if err := os.Chtimes(completionCachePath(key), old, old); err != nil {
+		t.Fatal(err)
+	}
+	complete(t, srv.URL, "results", "get", "")
+	if n := hits.Load(); n != 2 {
+		t.Errorf("server hit %d times after expiry, want 2", n)
+	}
+}
+
+func TestCompleteUnreachableServer(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	// A server that accepts but never answers must not hang the shell.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	got := complete(t, srv.URL, "watch", "job", "")
+	if len(got) != 0 {
+		t.Errorf("candidates %q from a silent server", got)
+	}
+	if d := time.Since(start); d > completionTimeout+time.Second {
+		t.Errorf("completion took %v", d)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("XDG_CACHE_HOME"), "simctl")); err == nil {
+		t.Error("a failed lookup was cached")
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	for shell, want := range map[string]string{
+		"bash": "complete -o default -F _simctl simctl",
+		"zsh":  "#compdef simctl",
+		"fish": "complete -c simctl",
+	} {
+		code, out, errOut := runCLI(t, "http://127.0.0.1:1", "", "completion", shell)
+		if code != 0 || !strings.Contains(out, want) || !strings.Contains(out, "simctl __complete --") {
+			t.Errorf("completion %s: exit %d, stderr %q, script:\n%s", shell, code, errOut, out)
+		}
+	}
+	if code, _, _ := runCLI(t, "http://127.0.0.1:1", "", "completion", "tcsh"); code != 2 {
+		t.Errorf("completion tcsh: exit %d, want 2", code)
+	}
+}
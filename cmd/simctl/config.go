@@ -0,0 +1,537 @@
+// config.go
+// Named connection profiles in ~/.config/simctl/config.yaml, the
+// flag > env > profile resolution of global settings, and simctl config.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// profile is one named set of connection settings. Timeout is kept as
+// written so a round trip through the file does not reformat it.
+type profile struct {
+	Server    string
+	Token     string
+	Namespace string
+	Timeout   string
+}
+
+// profileKeys are the settings a profile can hold, in file order.
+var profileKeys = []string{"server", "token", "namespace", "timeout"}
+
+func (p *profile) field(key string) *string {
+	switch key {
+	case "server":
+		return &p.Server
+	case "token":
+		return &p.Token
+	case "namespace":
+		return &p.Namespace
+	case "timeout":
+		return &p.Timeout
+	}
+	return nil
+}
+
+// set validates value for key before storing it.
+func (p *profile) set(key, value string) error {
+	f := p.field(key)
+	if f == nil {
+		return usagef("unknown setting %q (want one of %s)", key, strings.Join(profileKeys, ", "))
+	}
+	switch key {
+	case "server":
+		if err := checkServerURL(value); err != nil {
+			return err
+		}
+	case "timeout":
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return usagef("timeout %q is not a positive duration such as 30s", value)
+		}
+	}
+	*f = value
+	return nil
+}
+
+// config is the parsed config file.
+type config struct {
+	Current  string
+	Profiles map[string]*profile
+}
+
+// configPath is $SIMCTL_CONFIG, else config.yaml under $XDG_CONFIG_HOME
+// or ~/.config.
+func configPath() (string, error) {
+	if p := os.Getenv("SIMCTL_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("locating config file: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "simctl", "config.yaml"), nil
+}
+
+// loadConfig reads the config file at path; a missing file is an empty
+// config. It warns on warn when a file holding a token is readable by
+// other users.
+func loadConfig(path string, warn io.Writer) (*config, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &config{Profiles: map[string]*profile{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if fi, err := f.Stat(); err == nil && fi.Mode().Perm()&0o004 != 0 && runtime.GOOS != "windows" && cfg.hasToken() {
+		fmt.Fprintf(warn, "simctl: warning: %s holds API tokens and is readable by other users; run chmod 600 %s\n", path, path)
+	}
+	return cfg, nil
+}
+
+func (c *config) hasToken() bool {
+	for _, p := range c.Profiles {
+		if p.Token != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConfig reads the small YAML subset simctl writes:
+//
+//	current: dev
+//	profiles:
+//	  dev:
+//	    server: http://localhost:8080
+//	    timeout: 30s
+//
+// Comments, blank lines and single- or double-quoted values are accepted.
+func parseConfig(r io.Reader) (*config, error) {
+	cfg := &config{Profiles: map[string]*profile{}}
+	var (
+		inProfiles bool
+		cur        *profile
+	)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		raw := strings.TrimRight(sc.Text(), " \r")
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		key, err := yamlValueString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		value, err = yamlValueString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		switch indent := len(raw) - len(trimmed); {
+		case indent == 0:
+			inProfiles, cur = false, nil
+			switch key {
+			case "current":
+				cfg.Current = value
+			case "profiles":
+				if value != "" {
+					return nil, fmt.Errorf("line %d: profiles must be a mapping", n)
+				}
+				inProfiles = true
+			default:
+				return nil, fmt.Errorf("line %d: unknown key %q", n, key)
+			}
+		case indent == 2 && inProfiles:
+			if value != "" {
+				return nil, fmt.Errorf("line %d: profile %q must be a mapping", n, key)
+			}
+			cur = &profile{}
+			cfg.Profiles[key] = cur
+		case indent == 4 && cur != nil:
+			f := cur.field(key)
+			if f == nil {
+				return nil, fmt.Errorf("line %d: unknown profile setting %q", n, key)
+			}
+			*f = value
+		default:
+			return nil, fmt.Errorf("line %d: unexpected indentation", n)
+		}
+	}
+	return cfg, sc.Err()
+}
+
+// yamlValueString decodes a scalar, quoted or plain, dropping any
+// trailing comment.
+func yamlValueString(s string) (string, error) {
+	comment := func(rest string) bool {
+		rest = strings.TrimSpace(rest)
+		return rest == "" || strings.HasPrefix(rest, "#")
+	}
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil || !comment(s[i+1:]) {
+					break
+				}
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("bad double-quoted value %s", s)
+	case strings.HasPrefix(s, "'"):
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			if !comment(s[i+1:]) {
+				break
+			}
+			return strings.ReplaceAll(s[1:i], "''", "'"), nil
+		}
+		return "", fmt.Errorf("bad single-quoted value %s", s)
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+// write saves the config to path with owner-only permissions, replacing
+// the file atomically.
+func (c *config) write(path string) error {
+	var b strings.Builder
+	b.WriteString("# simctl configuration; edit with 'simctl config set'.\n")
+	if c.Current != "" {
+		b.WriteString("current: " + yamlString(c.Current) + "\n")
+	}
+	b.WriteString("profiles:\n")
+	for _, name := range c.names() {
+		b.WriteString("  " + yamlString(name) + ":\n")
+		p := c.Profiles[name]
+		for _, k := range profileKeys {
+			if v := *p.field(k); v != "" {
+				b.WriteString("    " + k + ": " + yamlString(v) + "\n")
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.WriteString(tmp, b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *config) names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileName picks the profile to use: --profile, then SIMCTL_PROFILE,
+// then the file's current profile.
+func (e *env) profileName(cfg *config) string {
+	if e.profile != "" {
+		return e.profile
+	}
+	if v := os.Getenv("SIMCTL_PROFILE"); v != "" {
+		return v
+	}
+	return cfg.Current
+}
+
+// settle fills in the global settings not given as flags, from the
+// environment, then the selected profile, then the defaults. It runs once,
+// before the first request.
+func (e *env) settle() error {
+	if e.settled {
+		return nil
+	}
+	e.settled = true
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(path, e.stderr)
+	if err != nil {
+		return err
+	}
+	p := &profile{}
+	if name := e.profileName(cfg); name != "" {
+		var ok bool
+		if p, ok = cfg.Profiles[name]; !ok {
+			return &notFoundError{msg: fmt.Sprintf("no profile %q in %s", name, path)}
+		}
+	}
+
+	// layer returns the environment's value, else the profile's, else def.
+	layer := func(envKey, fromProfile, def string) string {
+		if v := os.Getenv(envKey); v != "" {
+			return v
+		}
+		if fromProfile != "" {
+			return fromProfile
+		}
+		return def
+	}
+	if e.server == "" {
+		e.server = layer("SIMCTL_SERVER", p.Server, defaultServer)
+	}
+	if e.timeout == 0 {
+		v := layer("SIMCTL_TIMEOUT", p.Timeout, defaultTimeout.String())
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return usagef("invalid timeout %q: %v", v, err)
+		}
+		e.timeout = d
+	}
+	if e.namespace == "" {
+		e.namespace = layer("SIMCTL_NAMESPACE", p.Namespace, "")
+	}
+	// Tokens have no flag so they stay out of shell history and ps.
+	e.token = layer("SIMCTL_TOKEN", p.Token, "")
+	return nil
+}
+
+var configCmd = &command{
+	name:    "config",
+	summary: "manage connection profiles",
+	children: []*command{
+		{name: "set", summary: "set a profile setting", run: runConfigSet},
+		{name: "get", summary: "print a profile setting", run: runConfigGet},
+		{name: "list", summary: "list profiles", run: runConfigList},
+		{name: "use", summary: "make a profile the default", run: runConfigUse},
+	},
+	examples: []example{
+		{"create a staging profile", "simctl config set server https://staging.example --profile staging"},
+		{"store its token from stdin, keeping it out of ps and history", "pass show simctl/staging | simctl config set token - --profile staging"},
+		{"make it the default", "simctl config use staging"},
+		{"one command against another profile", "simctl --profile dev results list"},
+	},
+}
+
+// checkProfileName keeps names to characters that need no quoting in the
+// file or in shell completion.
+func checkProfileName(name string) error {
+	if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") != "" {
+		return usagef("invalid profile name %q: use letters, digits, '-', '_' and '.'", name)
+	}
+	return nil
+}
+
+// openConfig loads the config file for editing and names the profile the
+// command applies to.
+func (e *env) openConfig() (path string, cfg *config, name string, err error) {
+	if path, err = configPath(); err != nil {
+		return "", nil, "", err
+	}
+	if cfg, err = loadConfig(path, e.stderr); err != nil {
+		return "", nil, "", err
+	}
+	name = e.profileName(cfg)
+	if name == "" {
+		name = "default"
+	}
+	return path, cfg, name, nil
+}
+
+func runConfigSet(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl config set KEY VALUE|- [--profile NAME]")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return usagef("config set takes a key and a value, or - to read it from stdin (keys: %s)", strings.Join(profileKeys, ", "))
+	}
+	if rest[1] == "-" {
+		// Secrets passed as arguments show up in ps and shell history.
+		b, err := io.ReadAll(e.stdin)
+		if err != nil {
+			return fmt.Errorf("reading %s from stdin: %w", rest[0], err)
+		}
+		if rest[1] = strings.TrimRight(string(b), "\r\n"); rest[1] == "" {
+			return usagef("no %s on stdin", rest[0])
+		}
+	}
+	path, cfg, name, err := e.openConfig()
+	if err != nil {
+		return err
+	}
+	if err := checkProfileName(name); err != nil {
+		return err
+	}
+	p := cfg.Profiles[name]
+	if p == nil {
+		p = &profile{}
+	}
+	if err := p.set(rest[0], rest[1]); err != nil {
+		return err
+	}
+	cfg.Profiles[name] = p
+	if cfg.Current == "" {
+		cfg.Current = name
+	}
+	if err := cfg.write(path); err != nil {
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	return e.emit(map[string]any{"profile": name, "key": rest[0]}, func(w io.Writer) {
+		fmt.Fprintf(w, "set %s in profile %s\n", rest[0], name)
+	})
+}
+
+func runConfigGet(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl config get KEY [--profile NAME]")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("config get takes exactly one key")
+	}
+	_, cfg, name, err := e.openConfig()
+	if err != nil {
+		return err
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return &notFoundError{msg: fmt.Sprintf("no profile %q", name)}
+	}
+	f := p.field(rest[0])
+	if f == nil {
+		return usagef("unknown setting %q (want one of %s)", rest[0], strings.Join(profileKeys, ", "))
+	}
+	if *f == "" {
+		return &notFoundError{msg: fmt.Sprintf("%s is not set in profile %s", rest[0], name)}
+	}
+	return e.emit(map[string]any{"profile": name, "key": rest[0], "value": *f}, func(w io.Writer) {
+		fmt.Fprintln(w, *f)
+	})
+}
+
+// profileRow is one line of simctl config list. Tokens are reported only
+// as present or not.
+type profileRow struct {
+	Name      string `json:"name"`
+	Current   bool   `json:"current"`
+	Server    string `json:"server,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Timeout   string `json:"timeout,omitempty"`
+	Token     bool   `json:"token"`
+}
+
+func runConfigList(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl config list")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected arguments: %q", rest)
+	}
+	_, cfg, _, err := e.openConfig()
+	if err != nil {
+		return err
+	}
+	rows := []profileRow{}
+	for _, name := range cfg.names() {
+		p := cfg.Profiles[name]
+		rows = append(rows, profileRow{
+			Name: name, Current: name == cfg.Current,
+			Server: p.Server, Namespace: p.Namespace, Timeout: p.Timeout, Token: p.Token != "",
+		})
+	}
+	return e.emit(rows, nil)
+}
+
+func runConfigUse(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl config use NAME")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("config use takes exactly one profile name")
+	}
+	path, cfg, _, err := e.openConfig()
+	if err != nil {
+		return err
+	}
+	name := rest[0]
+	if _, ok := cfg.Profiles[name]; !ok {
+		return &notFoundError{msg: fmt.Sprintf("no profile %q in %s", name, path)}
+	}
+	cfg.Current = name
+	if err := cfg.write(path); err != nil {
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	return e.emit(map[string]any{"current": name}, func(w io.Writer) {
+		fmt.Fprintf(w, "now using profile %s\n", name)
+	})
+}
+
+// checkServerURL rejects anything but an absolute http(s) URL.
+func checkServerURL(s string) error {
+	u, err := url.Parse(strings.TrimRight(s, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return usagef("invalid server URL %q: want http(s)://host[:port]", s)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `# team profiles
+current: dev
+profiles:
+  dev:
+    server: http://dev.example:8080
+    timeout: 5s
+  prod:
+    server: "https://prod.example"
+    token: 'prod-token' # ci
+    namespace: research
+    timeout: 1m
+`
+
+func writeTestConfig(t *testing.T, body string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), mode); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(path, mode)
+	t.Setenv("SIMCTL_CONFIG", path)
+	return path
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := cfg.Profiles["prod"]
+	if cfg.Current != "dev" || len(cfg.Profiles) != 2 || prod == nil ||
+		*prod != (profile{Server: "https://prod.example", Token: "prod-token", Namespace: "research", Timeout: "1m"}) {
+		t.Errorf("parsed %+v, prod %+v", cfg, prod)
+	}
+
+	for _, bad := range []string{
+		"servers: x\n",
+		"profiles:\n  dev:\n    colour: red\n",
+		"profiles:\n  dev:\n\tserver: x\n",
+		"profiles:\n   dev:\n",
+		"current \n",
+		"profiles:\n  dev:\n    server: \"unterminated\n",
+		"profiles:\n  dev:\n    server: 'x' y\n",
+	} {
+		if _, err := parseConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseConfig(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestConfigWriteRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simctl", "config.yaml")
+	in := &config{Current: "a.b", Profiles: map[string]*profile{
+		"a.b": {Server: "http://h:1", Token: "t#1", Timeout: "10s"},
+		"yes": {Namespace: "ns"},
+	}}
+	if err := in.write(path); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("config mode %v (%v), want 0600", fi.Mode(), err)
+	}
+	out, err := loadConfig(path, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Current != in.Current || *out.Profiles["a.b"] != *in.Profiles["a.b"] || *out.Profiles["yes"] != *in.Profiles["yes"] {
+		t.Errorf("round trip: %+v", out)
+	}
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		flags       []string
+		env         map[string]string
+		wantServer  string
+		wantTimeout time.Duration
+		wantToken   string
+		wantNS      string
+	}{
+		{"defaults without a profile", nil, map[string]string{"SIMCTL_CONFIG": "none"}, defaultServer, defaultTimeout, "", ""},
+		{"current profile", nil, nil, "http://dev.example:8080", 5 * time.Second, "", ""},
+		{"env selects profile", nil, map[string]string{"SIMCTL_PROFILE": "prod"}, "https://prod.example", time.Minute, "prod-token", "research"},
+		{"flag selects profile over env", []string{"--profile", "dev"}, map[string]string{"SIMCTL_PROFILE": "prod"}, "http://dev.example:8080", 5 * time.Second, "", ""},
+		{"env overrides profile", []string{"--profile", "prod"},
+			map[string]string{"SIMCTL_SERVER": "http://env:1", "SIMCTL_TIMEOUT": "2s", "SIMCTL_TOKEN": "env-token", "SIMCTL_NAMESPACE": "env-ns"},
+			"http://env:1", 2 * time.Second, "env-token", "env-ns"},
+		{"flags override env", []string{"--profile", "prod", "--server", "http://flag:1", "--timeout", "3s", "--namespace", "flag-ns"},
+			map[string]string{"SIMCTL_SERVER": "http://env:1", "SIMCTL_TIMEOUT": "2s", "SIMCTL_NAMESPACE": "env-ns"},
+			"http://flag:1", 3 * time.Second, "prod-token", "flag-ns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestConfig(t, testConfig, 0o600)
+			for _, k := range []string{"SIMCTL_SERVER", "SIMCTL_TIMEOUT", "SIMCTL_PROFILE", "SIMCTL_TOKEN", "SIMCTL_NAMESPACE"} {
+				t.Setenv(k, "")
+			}
+			for k, v := range tt.env {
+				if k == "SIMCTL_CONFIG" {
+					v = filepath.Join(t.TempDir(), v)
+				}
+				t.Setenv(k, v)
+			}
+			e := &env{output: outputTable, stderr: io.Discard}
+			if _, err := parseArgs(e.flagSet("simctl test"), tt.flags); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.settle(); err != nil {
+				t.Fatal(err)
+			}
+			if e.server != tt.wantServer || e.timeout != tt.wantTimeout || e.token != tt.wantToken || e.namespace != tt.wantNS {
+				t.Errorf("got server %q timeout %s token %q namespace %q; want %q %s %q %q",
+					e.server, e.timeout, e.token, e.namespace, tt.wantServer, tt.wantTimeout, tt.wantToken, tt.wantNS)
+			}
+		})
+	}
+}
+
+func TestProfileSendsTokenAndNamespace(t *testing.T) {
+	var auth, ns string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, ns = r.Header.Get("Authorization"), r.Header.Get("X-Namespace")
+		writeJSONResponse(w, http.StatusOK, map[string]string{"version": "v1"})
+	}))
+	defer srv.Close()
+	writeTestConfig(t, "profiles:\n  ci:\n    server: "+srv.URL+"\n    token: s3cret\n    namespace: ci\n", 0o600)
+
+	var out strings.Builder
+	code := run(context.Background(), []string{"--profile", "ci", "version"}, strings.NewReader(""), &out, io.Discard)
+	if code != exitOK || auth != "Bearer s3cret" || ns != "ci" {
+		t.Errorf("exit %d, Authorization %q, X-Namespace %q", code, auth, ns)
+	}
+	if code := run(context.Background(), []string{"--profile", "nope", "version"}, strings.NewReader(""), io.Discard, io.Discard); code != exitNotFound {
+		t.Errorf("unknown profile: exit %d, want %d", code, exitNotFound)
+	}
+}
+
+func TestConfigWorldReadableWarning(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		mode os.FileMode
+		warn bool
+	}{
+		{testConfig, 0o644, true},
+		{testConfig, 0o600, false},
+		{"profiles:\n  dev:\n    server: http://h:1\n", 0o644, false},
+	} {
+		path := writeTestConfig(t, tt.body, tt.mode)
+		var stderr strings.Builder
+		if _, err := loadConfig(path, &stderr); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(stderr.String(), "readable by other users"); got != tt.warn {
+			t.Errorf("mode %v: warned %v, want %v", tt.mode, got, tt.warn)
+		}
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("SIMCTL_CONFIG", path)
+
+	steps := []struct {
+		args     []string
+		stdin    string
+		wantCode int
+		wantOut  string
+	}{
+		{[]string{"config", "set", "server", "http://dev:8080"}, "", exitOK, "set server in profile default\n"},
+		{[]string{"config", "set", "token", "abc", "--profile", "prod"}, "", exitOK, "set token in profile prod\n"},
+		{[]string{"config", "set", "timeout", "soon"}, "", exitUsage, ""},
+		{[]string{"config", "set", "colour", "red"}, "", exitUsage, ""},
+		{[]string{"config", "get", "server"}, "", exitOK, "http://dev:8080\n"},
+		{[]string{"config", "get", "namespace"}, "", exitNotFound, ""},
+		{[]string{"config", "use", "staging"}, "", exitNotFound, ""},
+		{[]string{"config", "use", "prod"}, "", exitOK, "now using profile prod\n"},
+		{[]string{"config", "get", "token"}, "", exitOK, "abc\n"},
+		{[]string{"config", "set", "token", "-"}, "s3cret\n", exitOK, "set token in profile prod\n"},
+		{[]string{"config", "get", "token"}, "", exitOK, "s3cret\n"},
+		{[]string{"config", "set", "token", "-"}, "\n", exitUsage, ""},
+		{[]string{"config", "list", "--output", "csv"}, "", exitOK, "name,current,server,token\ndefault,false,http://dev:8080,false\nprod,true,,true\n"},
+	}
+	for _, s := range steps {
+		code, stdout, stderr := runCLI(t, "http://127.0.0.1:1", s.stdin, s.args...)
+		if code != s.wantCode || (s.wantOut != "" && stdout != s.wantOut) {
+			t.Errorf("simctl %q: exit %d, stdout %q, stderr %q; want exit %d, %q", s.args, code, stdout, stderr, s.wantCode, s.wantOut)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+// diff.go
+// simctl diff A B: compare two heat or nbody results, on the server when it
+// has a diff endpoint and locally otherwise.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// maxDiffRows bounds the per-step or per-body rows in the human summary;
+// JSON output always has all of them.
+const maxDiffRows = 10
+
+var diffCmd = &command{
+	name:    "diff",
+	summary: "compare two results",
+	run:     runDiff,
+	examples: []example{
+		{"compare two stored results", "simctl diff heat_1715003456.json heat_1715009999.json"},
+		{"gate CI on a solver upgrade", "simctl diff baseline.json heat_1715009999.json --tolerance 1e-6 --json > diff.json"},
+	},
+}
+
+// diffReport is the outcome of a comparison. The server's diff endpoint
+// returns the same document.
+type diffReport struct {
+	A         string     `json:"a"`
+	B         string     `json:"b"`
+	Type      string     `json:"type"`
+	Source    string     `json:"source"` // "server" or "local"
+	Tolerance float64    `json:"tolerance"`
+	Within    bool       `json:"within_tolerance"`
+	MaxDelta  float64    `json:"max_delta"`
+	MaxStep   int        `json:"max_delta_step"`
+	MeanDelta float64    `json:"mean_delta"`
+	Steps     []stepDiff `json:"steps,omitempty"`
+	Bodies    []bodyDiff `json:"bodies,omitempty"`
+}
+
+// stepDiff is the absolute temperature difference over one heat frame.
+type stepDiff struct {
+	Step      int     `json:"step"`
+	MaxDelta  float64 `json:"max_delta"`
+	MeanDelta float64 `json:"mean_delta"`
+}
+
+// bodyDiff is how far one body's trajectories drift apart.
+type bodyDiff struct {
+	Body          int     `json:"body"`
+	MaxPosition   float64 `json:"max_position_delta"`
+	MaxStep       int     `json:"max_position_step"`
+	FinalPosition float64 `json:"final_position_delta"`
+	MaxVelocity   float64 `json:"max_velocity_delta"`
+}
+
+func runDiff(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl diff NAME|FILE NAME|FILE [--tolerance X]")
+	tolerance := fs.Float64("tolerance", 0, "largest absolute difference still considered equal")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return usagef("diff takes exactly two results: local paths or result names")
+	}
+	if *tolerance < 0 || math.IsNaN(*tolerance) {
+		return usagef("--tolerance must not be negative")
+	}
+	a, b := rest[0], rest[1]
+
+	var c *client
+	if !isLocalResult(a) || !isLocalResult(b) {
+		if c, err = e.client(); err != nil {
+			return err
+		}
+	}
+	var rep *diffReport
+	if c != nil && !isLocalResult(a) && !isLocalResult(b) {
+		rep, err = serverDiff(ctx, c, a, b, *tolerance)
+		if err != nil && !errors.Is(err, errNoServerDiff) {
+			return err
+		}
+	}
+	if rep == nil {
+		ra, err := loadResult(ctx, c, a)
+		if err != nil {
+			return err
+		}
+		rb, err := loadResult(ctx, c, b)
+		if err != nil {
+			return err
+		}
+		if rep, err = compareResults(ra, rb); err != nil {
+			return usagef("cannot compare %s and %s: %v", a, b, err)
+		}
+		rep.Source = "local"
+	}
+	rep.A, rep.B, rep.Tolerance = a, b, *tolerance
+	rep.Within = rep.MaxDelta <= *tolerance
+
+	if err := e.emit(rep, func(w io.Writer) { printDiff(w, rep) }); err != nil {
+		return err
+	}
+	if !rep.Within {
+		return fmt.Errorf("%s and %s differ by %s at step %d, more than --tolerance %s",
+			a, b, formatDelta(rep.MaxDelta), rep.MaxStep, formatDelta(*tolerance))
+	}
+	return nil
+}
+
+// isLocalResult reports whether arg names a file on disk; anything else is
+// taken to be the name of a stored result.
+func isLocalResult(arg string) bool {
+	fi, err := os.Stat(arg)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// errNoServerDiff means the server has no diff endpoint.
+var errNoServerDiff = errors.New("server has no diff endpoint")
+
+func serverDiff(ctx context.Context, c *client, a, b string, tolerance float64) (*diffReport, error) {
+	q := url.Values{"a": {a}, "b": {b}, "tolerance": {strconv.FormatFloat(tolerance, 'g', -1, 64)}}
+	var rep diffReport
+	err := c.getJSON(ctx, "/api/results/diff", q, &rep)
+	var ae *apiError
+	if errors.As(err, &ae) {
+		switch ae.Status {
+		// A 404 may also mean a missing result; the local path reports
+		// that with the result's name.
+		case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			return nil, errNoServerDiff
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	rep.Source = "server"
+	return &rep, nil
+}
+
+// storedResult is the part of a stored result file simctl compares: heat
+// frames carry a temperature grid, nbody frames one position (and
+// optionally velocity) vector per body.
+type storedResult struct {
+	Type   string        `json:"type"`
+	Frames []resultFrame `json:"frames"`
+}
+
+type resultFrame struct {
+	Step        *int        `json:"step"`
+	Temperature [][]float64 `json:"temperature"`
+	Positions   [][]float64 `json:"positions"`
+	Velocities  [][]float64 `json:"velocities"`
+}
+
+// step is the frame's step number, defaulting to its index.
+func (f *resultFrame) step(i int) int {
+	if f.Step != nil {
+		return *f.Step
+	}
+	return i
+}
+
+// loadResult reads arg from disk, or downloads it when it is not a file.
+func loadResult(ctx context.Context, c *client, arg string) (*storedResult, error) {
+	var data []byte
+	if isLocalResult(arg) {
+		b, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	} else {
+		var buf bytes.Buffer
+		if err := streamResult(ctx, c, arg, &buf); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	var r storedResult
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("decoding result %s: %w", arg, err)
+	}
+	if r.Type == "" && len(r.Frames) > 0 {
+		switch {
+		case r.Frames[0].Temperature != nil:
+			r.Type = "heat"
+		case r.Frames[0].Positions != nil:
+			r.Type = "nbody"
+		}
+	}
+	return &r, nil
+}
+
+// compareResults diffs two results of the same type and shape. The
+// returned error describes the mismatch when they are not comparable.
+func compareResults(a, b *storedResult) (*diffReport, error) {
+	if a.Type != b.Type {
+		return nil, fmt.Errorf("result types differ: %q and %q", a.Type, b.Type)
+	}
+	if len(a.Frames) != len(b.Frames) {
+		return nil, fmt.Errorf("frame counts differ: %d and %d", len(a.Frames), len(b.Frames))
+	}
+	if len(a.Frames) == 0 {
+		// Passing on nothing compared would let a CI gate pass on bad data.
+		return nil, errors.New("the results have no frames")
+	}
+	for i := range a.Frames {
+		if sa, sb := a.Frames[i].step(i), b.Frames[i].step(i); sa != sb {
+			return nil, fmt.Errorf("frame %d is step %d in one result and step %d in the other", i, sa, sb)
+		}
+	}
+	switch a.Type {
+	case "heat":
+		return compareHeat(a.Frames, b.Frames)
+	case "nbody":
+		return compareNBody(a.Frames, b.Frames)
+	}
+	return nil, fmt.Errorf("unsupported result type %q", a.Type)
+}
+
+func compareHeat(a, b []resultFrame) (*diffReport, error) {
+	rep := &diffReport{Type: "heat", Steps: []stepDiff{}}
+	var sum float64
+	var cells int
+	for i := range a {
+		ga, gb := a[i].Temperature, b[i].Temperature
+		if ga == nil || gb == nil {
+			return nil, fmt.Errorf("step %d has no temperature grid in %s", a[i].step(i), which(ga == nil, gb == nil))
+		}
+		if err := sameShape(ga, gb); err != nil {
+			return nil, fmt.Errorf("step %d: grids differ: %v", a[i].step(i), err)
+		}
+		sd := stepDiff{Step: a[i].step(i)}
+		var n int
+		for r := range ga {
+			for k := range ga[r] {
+				d := math.Abs(ga[r][k] - gb[r][k])
+				sd.MaxDelta = math.Max(sd.MaxDelta, d)
+				sd.MeanDelta += d
+				n++
+			}
+		}
+		sum += sd.MeanDelta
+		cells += n
+		if n > 0 {
+			sd.MeanDelta /= float64(n)
+		}
+		if sd.MaxDelta > rep.MaxDelta {
+			rep.MaxDelta, rep.MaxStep = sd.MaxDelta, sd.Step
+		}
+		rep.Steps = append(rep.Steps, sd)
+	}
+	if cells == 0 {
+		return nil, errors.New("the temperature grids are empty")
+	}
+	rep.MeanDelta = sum / float64(cells)
+	return rep, nil
+}
+
+func compareNBody(a, b []resultFrame) (*diffReport, error) {
+	rep := &diffReport{Type: "nbody", Bodies: []bodyDiff{}}
+	bodies := len(a[0].Positions)
+	for i := range bodies {
+		rep.Bodies = append(rep.Bodies, bodyDiff{Body: i})
+	}
+	var sum float64
+	var samples int
+	for i := range a {
+		step := a[i].step(i)
+		if a[i].Positions == nil || b[i].Positions == nil {
+			return nil, fmt.Errorf("step %d has no positions in %s", step, which(a[i].Positions == nil, b[i].Positions == nil))
+		}
+		if len(a[i].Positions) != bodies || len(b[i].Positions) != bodies {
+			return nil, fmt.Errorf("step %d: body counts differ: %d and %d", step, len(a[i].Positions), len(b[i].Positions))
+		}
+		compareVelocities := a[i].Velocities != nil && b[i].Velocities != nil
+		if compareVelocities && (len(a[i].Velocities) != bodies || len(b[i].Velocities) != bodies) {
+			return nil, fmt.Errorf("step %d: velocity counts differ: %d and %d", step, len(a[i].Velocities), len(b[i].Velocities))
+		}
+		for j := range rep.Bodies {
+			bd := &rep.Bodies[j]
+			d, err := distance(a[i].Positions[j], b[i].Positions[j])
+			if err != nil {
+				return nil, fmt.Errorf("step %d body %d: positions differ: %v", step, j, err)
+			}
+			if d > bd.MaxPosition {
+				bd.MaxPosition, bd.MaxStep = d, step
+			}
+			bd.FinalPosition = d
+			sum += d
+			samples++
+			if d > rep.MaxDelta {
+				rep.MaxDelta, rep.MaxStep = d, step
+			}
+			if compareVelocities {
+				v, err := distance(a[i].Velocities[j], b[i].Velocities[j])
+				if err != nil {
+					return nil, fmt.Errorf("step %d body %d: velocities differ: %v", step, j, err)
+				}
+				bd.MaxVelocity = math.Max(bd.MaxVelocity, v)
+			}
+		}
+	}
+	if samples == 0 {
+		return nil, errors.New("the results have no bodies")
+	}
+	rep.MeanDelta = sum / float64(samples)
+	return rep, nil
+}
+
+// which names the result or results missing something.
+func which(a, b bool) string {
+	switch {
+	case a && b:
+		return "either result"
+	case a:
+		return "the first result"
+	}
+	return "the second result"
+}
+
+func sameShape(a, b [][]float64) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%d and %d rows", len(a), len(b))
+	}
+	for r := range a {
+		if len(a[r]) != len(b[r]) {
+			return fmt.Errorf("row %d has %d and %d cells", r, len(a[r]), len(b[r]))
+		}
+	}
+	return nil
+}
+
+// distance is the Euclidean distance between two vectors of the same
+// dimension.
+func distance(a, b []float64) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("%d and %d dimensions", len(a), len(b))
+	}
+	if len(a) == 0 {
+		return 0, errors.New("no coordinates")
+	}
+	var sq float64
+	for k := range a {
+		d := a[k] - b[k]
+		sq += d * d
+	}
+	return math.Sqrt(sq), nil
+}
+
+// printDiff writes the human summary: the verdict, then the steps or
+// bodies over the tolerance, largest first.
+func printDiff(w io.Writer, rep *diffReport) {
+	verdict := "within"
+	if !rep.Within {
+		verdict = "EXCEEDS"
+	}
+	quantity := "|ΔT|"
+	if rep.Type == "nbody" {
+		quantity = "position divergence"
+	}
+	where := "locally"
+	if rep.Source == "server" {
+		where = "by the server"
+	}
+	fmt.Fprintf(w, "%s: %s vs %s (compared %s)\n", rep.Type, rep.A, rep.B, where)
+	fmt.Fprintf(w, "max %s %s at step %d, mean %s; %s tolerance %s\n",
+		quantity, formatDelta(rep.MaxDelta), rep.MaxStep, formatDelta(rep.MeanDelta), verdict, formatDelta(rep.Tolerance))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	shown, over := 0, 0
+	switch rep.Type {
+	case "heat":
+		for _, i := range worstFirst(len(rep.Steps), func(i int) float64 { return rep.Steps[i].MaxDelta }, rep.Tolerance) {
+			if over++; shown == maxDiffRows {
+				continue
+			}
+			if shown++; shown == 1 {
+				fmt.Fprintln(tw, "STEP\tMAX\tMEAN")
+			}
+			s := rep.Steps[i]
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Step, formatDelta(s.MaxDelta), formatDelta(s.MeanDelta))
+		}
+	case "nbody":
+		for _, i := range worstFirst(len(rep.Bodies), func(i int) float64 { return rep.Bodies[i].MaxPosition }, rep.Tolerance) {
+			if over++; shown == maxDiffRows {
+				continue
+			}
+			if shown++; shown == 1 {
+				fmt.Fprintln(tw, "BODY\tMAX POSITION\tAT STEP\tFINAL POSITION\tMAX VELOCITY")
+			}
+			b := rep.Bodies[i]
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", b.Body, formatDelta(b.MaxPosition), b.MaxStep, formatDelta(b.FinalPosition), formatDelta(b.MaxVelocity))
+		}
+	}
+	tw.Flush()
+	if over > shown {
+		fmt.Fprintf(w, "... and %d more over tolerance (see --json)\n", over-shown)
+	}
+}
+
+// worstFirst returns the indexes whose delta exceeds tolerance, largest
+// delta first and by index among equals, so the output is deterministic.
+func worstFirst(n int, delta func(int) float64, tolerance float64) []int {
+	var idx []int
+	for i := range n {
+		if delta(i) > tolerance {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return delta(idx[i]) > delta(idx[j]) })
+	return idx
+}
+
+func formatDelta(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	heatA = `{"type":"heat","frames":[
+		{"step":0,"temperature":[[0,0],[0,0]]},
+		{"step":10,"temperature":[[1,2],[3,4]]}]}`
+	heatB = `{"type":"heat","frames":[
+		{"step":0,"temperature":[[0,0],[0,0]]},
+		{"step":10,"temperature":[[1,2.5],[3,3]]}]}`
+	heatWide = `{"type":"heat","frames":[
+		{"step":0,"temperature":[[0,0,0],[0,0,0]]},
+		{"step":10,"temperature":[[1,2,3],[4,5,6]]}]}`
+	nbodyA = `{"frames":[
+		{"positions":[[0,0,0],[1,0,0]],"velocities":[[0,0,0],[0,1,0]]},
+		{"positions":[[0,0,0],[1,1,0]],"velocities":[[0,0,0],[0,1,0]]}]}`
+	nbodyB = `{"frames":[
+		{"positions":[[0,0,0],[1,0,0]],"velocities":[[0,0,0],[0,1,0]]},
+		{"positions":[[0,0,0],[1,4,4]],"velocities":[[0,0,0],[0,2,0]]}]}`
+)
+
+func writeResults(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDiffLocal(t *testing.T) {
+	dir := writeResults(t, map[string]string{
+		"a.json": heatA, "b.json": heatB, "wide.json": heatWide,
+		"n1.json": nbodyA, "n2.json": nbodyB,
+	})
+	p := func(name string) string { return filepath.Join(dir, name) }
+	const offline = "http://127.0.0.1:1"
+
+	code, out, stderr := runCLI(t, offline, "", "diff", p("a.json"), p("b.json"), "--json")
+	if code != exitFailure || !strings.Contains(stderr, "more than --tolerance 0") {
+		t.Fatalf("exit %d, stderr %q", code, stderr)
+	}
+	var rep diffReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatal(err)
+	}
+	want := []stepDiff{{Step: 0}, {Step: 10, MaxDelta: 1, MeanDelta: 0.375}}
+	if rep.Type != "heat" || rep.Source != "local" || rep.Within || rep.MaxDelta != 1 || rep.MaxStep != 10 ||
+		rep.MeanDelta != 0.1875 || len(rep.Steps) != 2 || rep.Steps[0] != want[0] || rep.Steps[1] != want[1] {
+		t.Errorf("report %+v", rep)
+	}
+
+	// The same inputs give byte-identical output, which CI diffs rely on.
+	if _, again, _ := runCLI(t, offline, "", "diff", p("a.json"), p("b.json"), "--json"); again != out {
+		t.Errorf("output changed between runs:\n%s\n%s", out, again)
+	}
+
+	if code, out, stderr := runCLI(t, offline, "", "diff", p("a.json"), p("b.json"), "--tolerance", "1"); code != exitOK ||
+		!strings.Contains(out, "max |ΔT| 1 at step 10, mean 0.1875; within tolerance 1") {
+		t.Errorf("--tolerance 1: exit %d, stdout %q, stderr %q", code, out, stderr)
+	}
+	if code, out, _ := runCLI(t, offline, "", "diff", p("a.json"), p("b.json"), "--tolerance", "0.1"); !strings.Contains(out, "EXCEEDS") ||
+		!strings.Contains(out, "STEP  MAX  MEAN\n10    1    0.375\n") || code != exitFailure {
+		t.Errorf("--tolerance 0.1: exit %d, stdout %q", code, out)
+	}
+
+	code, out, stderr = runCLI(t, offline, "", "diff", p("n1.json"), p("n2.json"), "--json")
+	rep = diffReport{}
+	json.Unmarshal([]byte(out), &rep)
+	wantBody := bodyDiff{Body: 1, MaxPosition: 5, MaxStep: 1, FinalPosition: 5, MaxVelocity: 1}
+	if code != exitFailure || rep.Type != "nbody" || rep.MaxDelta != 5 || len(rep.Bodies) != 2 ||
+		rep.Bodies[0] != (bodyDiff{}) || rep.Bodies[1] != wantBody {
+		t.Errorf("nbody: exit %d, report %+v, stderr %q", code, rep, stderr)
+	}
+
+	for _, pair := range [][2]string{{"a.json", "wide.json"}, {"a.json", "n1.json"}} {
+		code, _, stderr := runCLI(t, offline, "", "diff", p(pair[0]), p(pair[1]))
+		if code != exitUsage || !strings.Contains(stderr, "cannot compare") {
+			t.Errorf("diff %s %s: exit %d, stderr %q", pair[0], pair[1], code, stderr)
+		}
+	}
+}
+
+// TestDiffNothingCompared checks that results with no data to compare are
+// refused rather than passing with a zero delta.
+func TestDiffNothingCompared(t *testing.T) {
+	tests := []struct {
+		name, a, b, want string
+	}{
+		{
+			name: "grid key instead of temperature",
+			a:    `{"type":"heat","frames":[{"step":0,"grid":[[1,2]]}]}`,
+			b:    `{"type":"heat","frames":[{"step":0,"grid":[[100,200]]}]}`,
+			want: "step 0 has no temperature grid in either result",
+		},
+		{
+			name: "one frame missing its grid",
+			a:    heatA,
+			b:    `{"type":"heat","frames":[{"step":0,"temperature":[[0,0],[0,0]]},{"step":10}]}`,
+			want: "step 10 has no temperature grid in the second result",
+		},
+		{
+			name: "empty grids",
+			a:    `{"type":"heat","frames":[{"step":0,"temperature":[[]]}]}`,
+			b:    `{"type":"heat","frames":[{"step":0,"temperature":[[]]}]}`,
+			want: "the temperature grids are empty",
+		},
+		{
+			name: "no positions",
+			a:    `{"type":"nbody","frames":[{"step":0,"velocities":[[0,0,0]]}]}`,
+			b:    `{"type":"nbody","frames":[{"step":0,"velocities":[[0,0,1]]}]}`,
+			want: "step 0 has no positions in either result",
+		},
+		{
+			name: "no bodies",
+			a:    `{"type":"nbody","frames":[{"step":0,"positions":[]}]}`,
+			b:    `{"type":"nbody","frames":[{"step":0,"positions":[]}]}`,
+			want: "the results have no bodies",
+		},
+		{
+			name: "empty coordinates",
+			a:    `{"type":"nbody","frames":[{"step":0,"positions":[[]]}]}`,
+			b:    `{"type":"nbody","frames":[{"step":0,"positions":[[]]}]}`,
+			want: "no coordinates",
+		},
+		{
+			name: "no frames",
+			a:    `{"type":"heat","frames":[]}`,
+			b:    `{"type":"heat","frames":[]}`,
+			want: "the results have no frames",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeResults(t, map[string]string{"a.json": tt.a, "b.json": tt.b})
+			code, _, stderr := runCLI(t, "http://127.0.0.1:1", "", "diff",
+				filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"))
+			if code != exitUsage || !strings.Contains(stderr, "cannot compare") || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr %q; want exit %d mentioning %q", code, stderr, exitUsage, tt.want)
+			}
+		})
+	}
+}
+
+// diffServer serves result files and, when endpoint is set, the diff
+// endpoint.
+type diffServer struct {
+	files    map[string]string
+	endpoint bool
+	mu       sync.Mutex
+	paths    []string
+}
+
+func (s *diffServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.paths = append(s.paths, r.URL.Path)
+	s.mu.Unlock()
+	if r.URL.Path == "/api/results/diff" {
+		if !s.endpoint {
+			writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "no route"})
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("a") != "x.json" || q.Get("b") != "y.json" || q.Get("tolerance") != "0.5" {
+			writeJSONResponse(w, http.StatusBadRequest, map[string]any{"error": "bad query " + r.URL.RawQuery})
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, diffReport{Type: "heat", MaxDelta: 0.25, MaxStep: 3, MeanDelta: 0.01, Within: true})
+		return
+	}
+	body, ok := s.files[strings.TrimPrefix(r.URL.Path, "/api/results/")]
+	if !ok {
+		writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "result not found"})
+		return
+	}
+	w.Write([]byte(body))
+}
+
+func TestDiffRemote(t *testing.T) {
+	t.Run("server endpoint", func(t *testing.T) {
+		s := &diffServer{endpoint: true}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+		code, out, stderr := runCLI(t, ts.URL, "", "diff", "x.json", "y.json", "--tolerance", "0.5", "--json")
+		var rep diffReport
+		json.Unmarshal([]byte(out), &rep)
+		if code != exitOK || rep.Source != "server" || rep.A != "x.json" || rep.MaxDelta != 0.25 || !rep.Within {
+			t.Errorf("exit %d, report %+v, stderr %q", code, rep, stderr)
+		}
+		if len(s.paths) != 1 {
+			t.Errorf("requests %q, want only the diff endpoint", s.paths)
+		}
+	})
+
+	t.Run("local fallback", func(t *testing.T) {
+		s := &diffServer{files: map[string]string{"x.json": heatA, "y.json": heatB}}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+		code, out, stderr := runCLI(t, ts.URL, "", "diff", "x.json", "y.json", "--tolerance", "1", "--json")
+		var rep diffReport
+		json.Unmarshal([]byte(out), &rep)
+		if code != exitOK || rep.Source != "local" || rep.MaxDelta != 1 {
+			t.Errorf("exit %d, report %+v, stderr %q", code, rep, stderr)
+		}
+		if strings.Join(s.paths, " ") != "/api/results/diff /api/results/x.json /api/results/y.json" {
+			t.Errorf("requests %q", s.paths)
+		}
+	})
+
+	t.Run("local file and remote name", func(t *testing.T) {
+		s := &diffServer{endpoint: true, files: map[string]string{"y.json": heatA}}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+		local := filepath.Join(writeResults(t, map[string]string{"x.json": heatA}), "x.json")
+		if code, _, stderr := runCLI(t, ts.URL, "", "diff", local, "y.json"); code != exitOK {
+			t.Errorf("exit %d, stderr %q", code, stderr)
+		}
+		if strings.Join(s.paths, " ") != "/api/results/y.json" {
+			t.Errorf("requests %q: the server cannot diff a local file", s.paths)
+		}
+	})
+
+	t.Run("missing result", func(t *testing.T) {
+		ts := httptest.NewServer(&diffServer{files: map[string]string{"x.json": heatA}})
+		defer ts.Close()
+		if code, _, stderr := runCLI(t, ts.URL, "", "diff", "x.json", "gone.json"); code != exitNotFound {
+			t.Errorf("exit %d, stderr %q", code, stderr)
+		}
+	})
+}
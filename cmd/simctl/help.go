@@ -0,0 +1,182 @@
+// help.go
+// Help text for groups and commands, and the Markdown command reference
+// generated from the same command table and flag definitions.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// example is one usage example shown in help.
+type example struct {
+	desc string
+	cmd  string
+}
+
+// globalFlags are registered by every flagSet; command help lists them
+// once at the end instead of with each command's own flags.
+var globalFlags = map[string]bool{
+	"server": true, "timeout": true, "profile": true, "namespace": true,
+	"output": true, "json": true, "columns": true,
+}
+
+// printUsage shows a command group: its commands, examples and the global
+// flags.
+func printUsage(w io.Writer, prefix string, parent *command, table []*command) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags] [args]\n\nCommands:\n", prefix)
+	width := 0
+	for _, c := range table {
+		width = max(width, len(c.name))
+	}
+	for _, c := range table {
+		if !c.hidden {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, c.name, c.summary)
+		}
+	}
+	if parent != nil {
+		printExamples(w, parent.examples)
+	}
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	printFlags(w, rootFlagSet(), func(f *flag.Flag) bool { return true })
+	if parent == nil {
+		fmt.Fprintf(w, "\nRun 'simctl help COMMAND' for a command's flags and examples.\n")
+	}
+}
+
+// printFlagHelp is the -h text of a command built on fs.
+func (e *env) printFlagHelp(usage string, fs *flag.FlagSet) {
+	w := e.stderr
+	fmt.Fprintf(w, "Usage: %s\n", usage)
+	local := func(f *flag.Flag) bool { return !globalFlags[f.Name] }
+	if hasFlags(fs, local) {
+		fmt.Fprintf(w, "\nFlags:\n")
+		printFlags(w, fs, local)
+	}
+	printExamples(w, e.examples)
+	fmt.Fprintf(w, "\nGlobal flags: --server, --timeout, --profile, --namespace, --output, --json, --columns (see 'simctl help')\n")
+}
+
+func printExamples(w io.Writer, examples []example) {
+	if len(examples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nExamples:\n")
+	for _, ex := range examples {
+		fmt.Fprintf(w, "  # %s\n  %s\n", ex.desc, ex.cmd)
+	}
+}
+
+func hasFlags(fs *flag.FlagSet, keep func(*flag.Flag) bool) bool {
+	found := false
+	fs.VisitAll(func(f *flag.Flag) { found = found || keep(f) })
+	return found
+}
+
+// printFlags lists the flags of fs that keep selects, one aligned line
+// each. Placeholders come from backquoted words in the usage, as with
+// flag.PrintDefaults.
+func printFlags(w io.Writer, fs *flag.FlagSet, keep func(*flag.Flag) bool) {
+	type row struct{ left, usage string }
+	var rows []row
+	width := 0
+	fs.VisitAll(func(f *flag.Flag) {
+		if !keep(f) {
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		left := "--" + f.Name
+		if len(f.Name) == 1 {
+			left = "-" + f.Name
+		}
+		if name != "" && !isBoolFlag(f) {
+			left += " " + name
+		}
+		if !isZeroDefault(f) {
+			usage += " (default " + f.DefValue + ")"
+		}
+		rows = append(rows, row{left, usage})
+		width = max(width, len(left))
+	})
+	for _, r := range rows {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, r.left, r.usage)
+	}
+}
+
+func isZeroDefault(f *flag.Flag) bool {
+	switch f.DefValue {
+	case "", "0", "0s", "false", "[]", outputTable:
+		return true
+	}
+	return false
+}
+
+// rootFlagSet is the global flag set on a scratch env, for listing.
+func rootFlagSet() *flag.FlagSet {
+	e := &env{output: outputTable, stderr: io.Discard}
+	return e.flagSet("simctl")
+}
+
+// commandFlags returns the FlagSet c.run builds. Every command defines
+// its flags and parses before doing anything else, so running it with -h
+// on a scratch env yields the definitions without side effects.
+func commandFlags(c *command) *flag.FlagSet {
+	e := &env{output: outputTable, stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+	c.run(context.Background(), e, []string{"-h"})
+	return e.lastSet
+}
+
+// commandHelp is the -h text of the leaf command at path.
+func commandHelp(path []string) string {
+	var buf bytes.Buffer
+	e := &env{output: outputTable, stdin: strings.NewReader(""), stdout: io.Discard, stderr: &buf}
+	dispatch(context.Background(), e, "simctl", nil, commands, append(append([]string(nil), path...), "-h"))
+	return buf.String()
+}
+
+// writeReference writes the Markdown command reference, commands.md, from
+// the command table and each command's own help text.
+func writeReference(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# simctl command reference\n\n")
+	b.WriteString("Generated by `simctl help --markdown`; do not edit.\n\n")
+	var root bytes.Buffer
+	printUsage(&root, "simctl", nil, commands)
+	b.WriteString("```text\n" + root.String() + "```\n")
+
+	var walk func(path []string, table []*command)
+	walk = func(path []string, table []*command) {
+		for _, c := range table {
+			if c.hidden {
+				continue
+			}
+			p := append(append([]string(nil), path...), c.name)
+			level := strings.Repeat("#", min(len(p)+1, 4))
+			fmt.Fprintf(&b, "\n%s simctl %s\n\n%s.\n\n", level, strings.Join(p, " "), capitalize(c.summary))
+			if len(c.children) > 0 {
+				var group bytes.Buffer
+				printUsage(&group, "simctl "+strings.Join(p, " "), c, c.children)
+				// The global flags are listed once, at the top.
+				text, _, _ := strings.Cut(group.String(), "\nGlobal flags:\n")
+				b.WriteString("```text\n" + text + "```\n")
+				walk(p, c.children)
+				continue
+			}
+			b.WriteString("```text\n" + commandHelp(p) + "```\n")
+		}
+	}
+	walk(nil, commands)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
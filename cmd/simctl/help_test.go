@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCommandReferenceUpToDate keeps commands.md in step with the flag
+// definitions it is generated from.
+func TestCommandReferenceUpToDate(t *testing.T) {
+	want, err := os.ReadFile("commands.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := writeReference(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("commands.md is out of date; regenerate with: go run . help --markdown > commands.md")
+	}
+}
+
+func TestHelp(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		code int
+		want []string
+	}{
+		{[]string{"help"}, 0, []string{"Commands:", "  simulate", "Global flags:", "--server URL"}},
+		{[]string{"help", "results", "download"}, 0, []string{"Usage: simctl results download", "-o string", "Examples:", "Global flags: --server"}},
+		{[]string{"results", "download", "-h"}, 0, []string{"Usage: simctl results download", "Examples:"}},
+		{[]string{"config"}, 2, []string{"Commands:", "  use", "Examples:", "simctl config use staging"}},
+	} {
+		code, out, errOut := runCLI(t, "http://127.0.0.1:1", "", tc.args...)
+		if code != tc.code {
+			t.Errorf("%q: exit %d, want %d", tc.args, code, tc.code)
+		}
+		all := out + errOut
+		for _, w := range tc.want {
+			if !strings.Contains(all, w) {
+				t.Errorf("%q: output lacks %q:\n%s", tc.args, w, all)
+			}
+		}
+		if strings.Contains(all, "__complete") {
+			t.Errorf("%q: hidden command listed:\n%s", tc.args, all)
+		}
+	}
+}
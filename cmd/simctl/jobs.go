@@ -0,0 +1,172 @@
+// jobs.go
+// Async job model and polling shared by simulate --wait and later watchers.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+const defaultPollInterval = time.Second
+
+// job mirrors the job status document served at /api/jobs/:id.
+type job struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type,omitempty"`
+	State    string   `json:"state"`
+	Progress *float64 `json:"progress,omitempty"` // percent complete, 0-100
+	Filename string   `json:"filename,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Job states reported by the server.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+func (j *job) terminal() bool {
+	switch j.State {
+	case jobSucceeded, jobFailed, jobCancelled:
+		return true
+	}
+	return false
+}
+
+// err returns nil for a succeeded job and a descriptive error otherwise.
+func (j *job) err() error {
+	if j.State == jobSucceeded {
+		return nil
+	}
+	if j.Error != "" {
+		return fmt.Errorf("job %s %s: %s", j.ID, j.State, j.Error)
+	}
+	return fmt.Errorf("job %s %s", j.ID, j.State)
+}
+
+func (j *job) String() string {
+	s := j.State
+	if j.Progress != nil && !j.terminal() {
+		s += fmt.Sprintf(" %3.0f%%", *j.Progress)
+	}
+	return s
+}
+
+func getJob(ctx context.Context, c *client, id string) (*job, error) {
+	var j job
+	if err := c.getJSON(ctx, "/api/jobs/"+url.PathEscape(id), nil, &j); err != nil {
+		return nil, err
+	}
+	if j.ID == "" {
+		j.ID = id
+	}
+	return &j, nil
+}
+
+// listJobs fetches /api/jobs, accepting either a bare array or one wrapped
+// as {"jobs": [...]}.
+func listJobs(ctx context.Context, c *client) ([]job, error) {
+	var raw json.RawMessage
+	if err := c.getJSON(ctx, "/api/jobs", nil, &raw); err != nil {
+		return nil, err
+	}
+	var jobs []job
+	if err := json.Unmarshal(raw, &jobs); err != nil {
+		var wrapped struct {
+			Jobs []job `json:"jobs"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, fmt.Errorf("decoding job listing: %w", err)
+		}
+		jobs = wrapped.Jobs
+	}
+	return jobs, nil
+}
+
+// pollJob waits for the job like followJob, showing a spinner on
+// progress when it is a terminal.
+func pollJob(ctx context.Context, c *client, id string, interval time.Duration, progress io.Writer) (*job, error) {
+	sp := newSpinner(progress)
+	defer sp.done()
+	return followJob(ctx, c, id, interval, func(j *job) {
+		sp.update("job " + id + " " + j.String())
+	})
+}
+
+// followJob polls the job every interval, passing each status to update,
+// until it reaches a terminal state. It returns the last status seen; an
+// interrupted wait returns an *interruptedError and leaves the job running
+// on the server.
+func followJob(ctx context.Context, c *client, id string, interval time.Duration, update func(*job)) (*job, error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		j, err := getJob(ctx, c, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, detached(id)
+			}
+			return nil, err
+		}
+		update(j)
+		if j.terminal() {
+			return j, nil
+		}
+		select {
+		case <-ctx.Done():
+			return j, detached(id)
+		case <-t.C:
+		}
+	}
+}
+
+func detached(id string) error {
+	return &interruptedError{msg: fmt.Sprintf("interrupted; job %s is still running on the server", id)}
+}
+
+// cancelJob asks the server to cancel the job. It runs on its own
+// deadline so it still works after the command's context was interrupted.
+func cancelJob(c *client, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.postJSON(ctx, "/api/jobs/"+url.PathEscape(id)+"/cancel", nil, nil, nil)
+}
+
+// spinner redraws a single status line in place. It is silent unless w is
+// a terminal, so redirected output never collects carriage returns.
+type spinner struct {
+	w     io.Writer
+	frame int
+	width int
+}
+
+func newSpinner(w io.Writer) *spinner {
+	if !isTerminal(w) {
+		return &spinner{}
+	}
+	return &spinner{w: w}
+}
+
+func (s *spinner) update(msg string) {
+	if s.w == nil {
+		return
+	}
+	const frames = `|/-\`
+	line := fmt.Sprintf("%c %s", frames[s.frame%len(frames)], msg)
+	s.frame++
+	fmt.Fprintf(s.w, "\r%-*s", s.width, line)
+	s.width = max(s.width, len(line))
+}
+
+func (s *spinner) done() {
+	if s.w != nil && s.width > 0 {
+		fmt.Fprintf(s.w, "\r%*s\r", s.width, "")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestJobTerminalStates(t *testing.T) {
+	for state, terminal := range map[string]bool{
+		jobQueued: false, jobRunning: false, jobSucceeded: true, jobFailed: true, jobCancelled: true,
+	} {
+		j := &job{ID: "j1", State: state}
+		if j.terminal() != terminal {
+			t.Errorf("%s: terminal() = %v, want %v", state, j.terminal(), terminal)
+		}
+		if (j.err() == nil) != (state == jobSucceeded) {
+			t.Errorf("%s: err() = %v", state, j.err())
+		}
+	}
+}
+
+func TestJobString(t *testing.T) {
+	p := 42.0
+	if got := (&job{State: jobRunning, Progress: &p}).String(); got != "running  42%" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := (&job{State: jobSucceeded, Progress: &p}).String(); got != "succeeded" {
+		t.Errorf("String() = %q", got)
+	}
+}
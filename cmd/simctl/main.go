@@ -0,0 +1,296 @@
+// main.go
+// simctl entry point: global flags, subcommand dispatch and exit codes.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exit codes are shared by every subcommand so scripts can branch on them.
+const (
+	exitOK        = 0 // success
+	exitFailure   = 1 // server-side or otherwise unexpected failure
+	exitUsage     = 2 // bad flags/arguments, or input the server rejected
+	exitNotFound  = 3 // the named result, job or profile does not exist
+	exitTransport = 4 // server unreachable, timed out or connection broken
+
+	exitInterrupted = 130 // stopped by Ctrl-C, as shells report SIGINT
+)
+
+const (
+	defaultServer  = "http://localhost:8080"
+	defaultTimeout = 30 * time.Second
+)
+
+// env carries the global settings and I/O streams handed to every command.
+// Connection settings are zero unless given as flags until settle fills in
+// the rest from the environment and the selected profile.
+type env struct {
+	server    string
+	timeout   time.Duration
+	profile   string
+	namespace string
+	token     string
+	output    outputFlag
+	columns   string
+	settled   bool
+
+	examples []example     // shown by -h: the command's, or its parent's
+	lastSet  *flag.FlagSet // most recent flagSet, read by help and completion
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is one simctl subcommand. Commands with children dispatch on
+// their first argument instead of running themselves. Examples are shown
+// by -h and in the generated reference; children without their own show
+// their parent's.
+type command struct {
+	name     string
+	summary  string
+	run      func(ctx context.Context, e *env, args []string) error
+	children []*command
+	examples []example
+	hidden   bool // left out of help, e.g. the completion helper
+}
+
+// commands is the root command table, in the order shown by help. It is
+// filled in by init because completion and help walk the table themselves.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		simulateCmd,
+		optimizeCmd,
+		sweepCmd,
+		resultsCmd,
+		diffCmd,
+		watchCmd,
+		configCmd,
+		completionCmd,
+		versionCmd,
+		completeCmd,
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes simctl with the given arguments and returns the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	e := &env{
+		output: outputTable,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	fs := e.flagSet("simctl")
+	fs.Usage = func() { printUsage(stderr, "simctl", nil, commands) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		printUsage(stderr, "simctl", nil, commands)
+		return exitUsage
+	}
+
+	err := dispatch(ctx, e, "simctl", nil, commands, fs.Args())
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil && ctx.Err() != nil {
+		err = interrupted(err)
+	}
+	if err != nil {
+		e.reportError(err)
+	}
+	return exitCode(err)
+}
+
+// dispatch finds the command named by args[0] in table and runs it.
+// "help CMD..." shows that command's -h text.
+func dispatch(ctx context.Context, e *env, prefix string, parent *command, table []*command, args []string) error {
+	if len(args) > 1 && args[0] == "help" {
+		if args[1] == "--markdown" {
+			return writeReference(e.stdout)
+		}
+		return dispatch(ctx, e, prefix, parent, table, append(args[1:], "-h"))
+	}
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(e.stderr, prefix, parent, table)
+		if len(args) == 0 {
+			return usagef("missing subcommand (see '%s help')", prefix)
+		}
+		return flag.ErrHelp
+	}
+	for _, c := range table {
+		if c.name != args[0] {
+			continue
+		}
+		name := prefix + " " + c.name
+		if len(c.examples) > 0 {
+			e.examples = c.examples
+		}
+		if len(c.children) > 0 {
+			return dispatch(ctx, e, name, c, c.children, args[1:])
+		}
+		return c.run(ctx, e, args[1:])
+	}
+	return usagef("unknown command %q (see '%s help')", args[0], prefix)
+}
+
+// flagSet returns a FlagSet with the global flags already registered, so
+// they are accepted before or after the subcommand. usage is the synopsis
+// printed above the flag defaults by -h.
+func (e *env) flagSet(usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(strings.Fields(usage)[0], flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() { e.printFlagHelp(usage, fs) }
+	e.lastSet = fs
+	fs.StringVar(&e.server, "server", e.server, "API server base `URL` (env SIMCTL_SERVER, default "+defaultServer+")")
+	fs.DurationVar(&e.timeout, "timeout", e.timeout, "wait at most `DUR` per request (env SIMCTL_TIMEOUT, default "+defaultTimeout.String()+")")
+	fs.StringVar(&e.profile, "profile", e.profile, "config profile `NAME` to use (env SIMCTL_PROFILE)")
+	fs.StringVar(&e.namespace, "namespace", e.namespace, "namespace `NS` sent with every request (env SIMCTL_NAMESPACE)")
+	fs.Var(&e.output, "output", "output `FORMAT`: table (default), json, csv or yaml")
+	fs.Var(jsonFlag{&e.output}, "json", "shorthand for --output json")
+	fs.StringVar(&e.columns, "columns", e.columns, "show only these comma-separated `COLUMNS` in table and csv output")
+	return fs
+}
+
+// parseArgs parses fs from args, allowing flags to follow positional
+// arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, &usageError{msg: err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usageError reports bad command-line input; it maps to exitUsage.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// notFoundError reports a missing local object such as a profile; it maps
+// to exitNotFound like a 404 from the server.
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string { return e.msg }
+
+// interruptedError reports that the user stopped the command with Ctrl-C.
+type interruptedError struct {
+	msg string
+}
+
+func (e *interruptedError) Error() string { return e.msg }
+
+// interrupted reports a command that failed because Ctrl-C cancelled its
+// context, usually as a transport error wrapping context.Canceled, as an
+// *interruptedError. Commands that return their own keep its message.
+func interrupted(err error) error {
+	var ie *interruptedError
+	if errors.As(err, &ie) {
+		return err
+	}
+	return &interruptedError{msg: "interrupted: " + err.Error()}
+}
+
+// exitCode maps an error returned by a command to the process exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ue *usageError
+	var ae *apiError
+	var te *transportError
+	var ie *interruptedError
+	var nf *notFoundError
+	switch {
+	case errors.As(err, &ie):
+		return exitInterrupted
+	case errors.As(err, &ue):
+		return exitUsage
+	case errors.As(err, &nf):
+		return exitNotFound
+	case errors.As(err, &ae):
+		switch ae.Status {
+		case 404, 410:
+			return exitNotFound
+		case 400, 409, 413, 422:
+			return exitUsage
+		}
+		return exitFailure
+	case errors.As(err, &te):
+		return exitTransport
+	}
+	return exitFailure
+}
+
+// reportError prints err to stderr, as a JSON object in JSON output mode.
+func (e *env) reportError(err error) {
+	if e.jsonOutput() {
+		out := map[string]any{"message": err.Error(), "exit_code": exitCode(err)}
+		var ae *apiError
+		if errors.As(err, &ae) {
+			out["status"] = ae.Status
+			if ae.Code != "" {
+				out["code"] = ae.Code
+			}
+			if ae.RequestID != "" {
+				out["request_id"] = ae.RequestID
+			}
+			if len(ae.Details) > 0 {
+				out["details"] = ae.Details
+			}
+		}
+		writeJSON(e.stderr, map[string]any{"error": out})
+		return
+	}
+	fmt.Fprintf(e.stderr, "simctl: %v\n", err)
+	var ae *apiError
+	if errors.As(err, &ae) && len(ae.Details) > 0 {
+		details := append([]fieldError(nil), ae.Details...)
+		sort.SliceStable(details, func(i, j int) bool { return details[i].Field < details[j].Field })
+		for _, d := range details {
+			fmt.Fprintf(e.stderr, "  %s: %s\n", strings.TrimPrefix(d.Field, "/"), d.Message)
+		}
+	}
+}
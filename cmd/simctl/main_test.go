@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"usage", usagef("bad flag"), exitUsage},
+		{"wrapped usage", fmt.Errorf("simulate: %w", usagef("bad flag")), exitUsage},
+		{"validation", &apiError{Status: 422}, exitUsage},
+		{"bad request", &apiError{Status: 400}, exitUsage},
+		{"not found", &apiError{Status: 404}, exitNotFound},
+		{"gone", &apiError{Status: 410}, exitNotFound},
+		{"server error", &apiError{Status: 500}, exitFailure},
+		{"unavailable", &apiError{Status: 503}, exitFailure},
+		{"transport", &transportError{Op: "GET /api/results", Err: errors.New("connection refused")}, exitTransport},
+		{"other", errors.New("boom"), exitFailure},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseArgsFlagsAfterPositionals(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantPos  []string
+		wantJSON bool
+		wantYes  bool
+	}{
+		{[]string{"a.json"}, []string{"a.json"}, false, false},
+		{[]string{"a.json", "--json"}, []string{"a.json"}, true, false},
+		{[]string{"--yes", "a.json", "b.json", "--json"}, []string{"a.json", "b.json"}, true, true},
+		{[]string{"a.json", "--yes", "b.json"}, []string{"a.json", "b.json"}, false, true},
+	}
+	for _, tt := range tests {
+		e := &env{output: outputTable, stderr: io.Discard}
+		fs := e.flagSet("simctl test")
+		yes := fs.Bool("yes", false, "")
+		pos, err := parseArgs(fs, tt.args)
+		if err != nil {
+			t.Errorf("parseArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(pos, tt.wantPos) || e.jsonOutput() != tt.wantJSON || *yes != tt.wantYes {
+			t.Errorf("parseArgs(%q) = %q json=%v yes=%v; want %q json=%v yes=%v",
+				tt.args, pos, e.jsonOutput(), *yes, tt.wantPos, tt.wantJSON, tt.wantYes)
+		}
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	e := &env{stderr: io.Discard}
+	if _, err := parseArgs(e.flagSet("simctl test"), []string{"--nope"}); exitCode(err) != exitUsage {
+		t.Errorf("unknown flag: err %v, want a usage error", err)
+	}
+	if _, err := parseArgs(e.flagSet("simctl test"), []string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("-h: err %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestRunDispatch(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, exitUsage},
+		{[]string{"bogus"}, exitUsage},
+		{[]string{"help"}, exitOK},
+		{[]string{"-h"}, exitOK},
+		{[]string{"simulate"}, exitUsage},
+		{[]string{"simulate", "help"}, exitOK},
+		{[]string{"version", "--client"}, exitOK},
+	}
+	for _, tt := range tests {
+		if code, _, _ := runCLI(t, "http://127.0.0.1:1", "", tt.args...); code != tt.want {
+			t.Errorf("simctl %q: exit %d, want %d", tt.args, code, tt.want)
+		}
+	}
+}
+
+// TestInterruptedRequest stands in for Ctrl-C while a request, or a
+// download's body, is in flight: every command exits 130, not 4.
+func TestInterruptedRequest(t *testing.T) {
+	stop := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/results/") {
+			w.Header().Set("Content-Length", "1000")
+			w.Write(make([]byte, 100))
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer ts.Close()
+	defer close(stop)
+	params := filepath.Join(t.TempDir(), "p.json")
+	if err := os.WriteFile(params, []byte(`{"steps": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"simulate", "heat", "--params", params},
+		{"optimize", "heat", "--goal", params},
+		{"results", "list"},
+		{"results", "download", "heat_1.json", "-o", filepath.Join(t.TempDir(), "out.json")},
+		{"results", "download", "heat_1.json", "-o", "-"},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		code, _, stderr := runCLIContext(ctx, t, ts.URL, "", args...)
+		cancel()
+		if code != exitInterrupted || !strings.Contains(stderr, "interrupted") {
+			t.Errorf("%q: exit %d, stderr %q", args, code, stderr)
+		}
+	}
+}
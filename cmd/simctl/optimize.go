@@ -0,0 +1,130 @@
+// optimize.go
+// simctl optimize heat|nbody: ask the optimizer for parameters meeting a
+// goal, optionally saving them or running them through the pipeline.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+var optimizeCmd = &command{
+	name:     "optimize",
+	summary:  "suggest simulation parameters for a goal",
+	children: simTypeCommands("optimize %s parameters", runOptimize),
+	examples: []example{
+		{"print suggested parameters and keep a copy", "simctl optimize heat --goal goal.json --save params.json"},
+		{"feed the suggestion straight into a simulation", "simctl optimize heat --goal goal.json | simctl simulate heat --params -"},
+		{"optimize and run through the pipeline", "simctl optimize nbody --goal goal.json --run --wait"},
+	},
+}
+
+// suggestion is the optimizer's response. Params is kept verbatim so the
+// JSON written out round-trips exactly into simctl simulate --params.
+type suggestion struct {
+	Params     json.RawMessage `json:"params"`
+	Objective  *float64        `json:"objective,omitempty"`
+	Iterations int             `json:"iterations,omitempty"`
+}
+
+func runOptimize(ctx context.Context, e *env, simType string, args []string) error {
+	fs := e.flagSet("simctl optimize " + simType + " --goal FILE|- [--save FILE] [--run [--wait]] [--timeout DUR]")
+	goalPath := fs.String("goal", "", "JSON goal file, or - for stdin (required)")
+	save := fs.String("save", "", "also write the suggested parameters to this file")
+	runIt := fs.Bool("run", false, "submit a simulation with the suggestion through the pipeline")
+	wait := fs.Bool("wait", false, "with --run, poll the job until it finishes (implies --run)")
+	poll := fs.Duration("poll", defaultPollInterval, "job polling interval for --wait")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected arguments: %q", rest)
+	}
+	if *goalPath == "" {
+		return usagef("--goal is required")
+	}
+	if *poll <= 0 {
+		return usagef("--poll must be positive")
+	}
+	goal, err := readJSONInput(e, *goalPath, "goal")
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	// The optimizer can take a while; --timeout bounds this request like
+	// any other.
+	var raw json.RawMessage
+	if err := c.postJSON(ctx, "/api/optimize/"+simType, nil, goal, &raw); err != nil {
+		return fmt.Errorf("optimize %s: %w", simType, err)
+	}
+	sug, err := decodeSuggestion(raw)
+	if err != nil {
+		return err
+	}
+	params := indentJSON(sug.Params)
+	if *save != "" {
+		if err := os.WriteFile(*save, params, 0o644); err != nil {
+			return fmt.Errorf("saving parameters: %w", err)
+		}
+	}
+	if sug.Objective != nil {
+		fmt.Fprintf(e.stderr, "objective %g after %d iterations\n", *sug.Objective, sug.Iterations)
+	}
+	if *save != "" {
+		fmt.Fprintf(e.stderr, "saved parameters to %s\n", *save)
+	}
+
+	if !*runIt && !*wait {
+		return e.emit(sug.Params, func(w io.Writer) { w.Write(params) })
+	}
+	sub, err := submitJob(ctx, c, "/api/pipeline/"+simType, sug.Params)
+	if err != nil {
+		return fmt.Errorf("running suggested parameters: %w", err)
+	}
+	if !*wait {
+		return e.emit(sub, func(w io.Writer) { fmt.Fprintln(w, sub.JobID) })
+	}
+	j, err := pollJob(ctx, c, sub.JobID, *poll, e.stderr)
+	if err != nil {
+		return err
+	}
+	if err := e.emit(j, func(w io.Writer) { printJob(w, j) }); err != nil {
+		return err
+	}
+	return j.err()
+}
+
+// decodeSuggestion accepts {"params": {...}, ...} or a bare parameter
+// object.
+func decodeSuggestion(raw json.RawMessage) (*suggestion, error) {
+	var sug suggestion
+	if err := json.Unmarshal(raw, &sug); err != nil {
+		return nil, fmt.Errorf("decoding optimizer response: %w", err)
+	}
+	if len(sug.Params) == 0 || bytes.Equal(sug.Params, []byte("null")) {
+		sug = suggestion{Params: raw}
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(sug.Params), []byte("{")) {
+		return nil, fmt.Errorf("optimizer returned parameters that are not a JSON object")
+	}
+	return &sug, nil
+}
+
+// indentJSON pretty-prints a valid JSON document for saving and display.
+func indentJSON(raw json.RawMessage) []byte {
+	var b bytes.Buffer
+	if err := json.Indent(&b, raw, "", "  "); err != nil {
+		return append([]byte(nil), raw...)
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
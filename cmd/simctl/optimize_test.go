@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// optServer fakes /api/optimize and /api/pipeline. Goals without a target
+// fail validation the way the optimizer reports it.
+type optServer struct {
+	mu       sync.Mutex
+	pipeline []string // bodies posted to the pipeline
+	delay    time.Duration
+}
+
+func (s *optServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/api/optimize/heat":
+		time.Sleep(s.delay)
+		var goal map[string]any
+		json.NewDecoder(r.Body).Decode(&goal)
+		if _, ok := goal["target"]; !ok {
+			writeJSONResponse(w, http.StatusUnprocessableEntity, map[string]any{"error": map[string]any{
+				"code": "invalid_goal", "message": "goal rejected by optimizer",
+				"details": []fieldError{{Field: "/target", Message: "required"}},
+			}})
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]any{
+			"params":    map[string]any{"dt": 0.01, "steps": 400},
+			"objective": 0.97, "iterations": 12,
+		})
+	case r.URL.Path == "/api/pipeline/heat" && r.URL.Query().Get("async") == "true":
+		b, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.pipeline = append(s.pipeline, string(b))
+		s.mu.Unlock()
+		writeJSONResponse(w, http.StatusAccepted, map[string]string{"job_id": "p1"})
+	case r.URL.Path == "/api/jobs/p1":
+		writeJSONResponse(w, http.StatusOK, job{ID: "p1", State: jobSucceeded, Filename: "heat_7.json"})
+	default:
+		writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "not found"})
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	const goal = `{"target": {"max_temp": 80}}`
+	const wantParams = "{\n  \"dt\": 0.01,\n  \"steps\": 400\n}\n"
+	tests := []struct {
+		name         string
+		stdin        string
+		args         []string
+		wantCode     int
+		wantOut      string
+		wantErr      []string
+		wantPipeline bool
+	}{
+		{name: "prints params", stdin: goal, wantCode: exitOK, wantOut: wantParams,
+			wantErr: []string{"objective 0.97 after 12 iterations"}},
+		{name: "json emits the raw params", stdin: goal, args: []string{"--json"}, wantCode: exitOK, wantOut: wantParams},
+		{name: "validation errors", stdin: `{}`, wantCode: exitUsage,
+			wantErr: []string{"optimize heat: server returned 422", "goal rejected by optimizer", "  target: required"}},
+		{name: "bad goal json", stdin: `{`, wantCode: exitUsage, wantErr: []string{"goal in stdin: not valid JSON"}},
+		{name: "run", stdin: goal, args: []string{"--run"}, wantCode: exitOK, wantOut: "p1\n", wantPipeline: true},
+		{name: "run and wait", stdin: goal, args: []string{"--wait", "--poll", "10ms"}, wantCode: exitOK,
+			wantOut: "job p1 succeeded\n  result: heat_7.json\n", wantPipeline: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &optServer{}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+			args := append([]string{"optimize", "heat", "--goal", "-"}, tt.args...)
+			code, stdout, stderr := runCLI(t, ts.URL, tt.stdin, args...)
+			if code != tt.wantCode {
+				t.Fatalf("exit %d, want %d; stderr: %s", code, tt.wantCode, stderr)
+			}
+			if tt.wantOut != "" && stdout != tt.wantOut {
+				t.Errorf("stdout %q, want %q", stdout, tt.wantOut)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(stderr, want) {
+					t.Errorf("stderr missing %q:\n%s", want, stderr)
+				}
+			}
+			if tt.wantPipeline {
+				if len(srv.pipeline) != 1 || !json.Valid([]byte(srv.pipeline[0])) || !strings.Contains(srv.pipeline[0], `"steps":400`) {
+					t.Errorf("pipeline bodies %q", srv.pipeline)
+				}
+			} else if len(srv.pipeline) != 0 {
+				t.Errorf("pipeline called without --run: %q", srv.pipeline)
+			}
+		})
+	}
+}
+
+func TestOptimizeSaveFeedsSimulate(t *testing.T) {
+	ts := httptest.NewServer(&optServer{})
+	defer ts.Close()
+	dir := t.TempDir()
+	goal := filepath.Join(dir, "goal.json")
+	os.WriteFile(goal, []byte(`{"target": 1}`), 0o644)
+	saved := filepath.Join(dir, "params.json")
+
+	if code, _, stderr := runCLI(t, ts.URL, "", "optimize", "heat", "--goal", goal, "--save", saved); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	b, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p struct {
+		DT    float64 `json:"dt"`
+		Steps int     `json:"steps"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil || p.DT != 0.01 || p.Steps != 400 {
+		t.Errorf("saved %q (%v)", b, err)
+	}
+}
+
+func TestOptimizeTimeout(t *testing.T) {
+	ts := httptest.NewServer(&optServer{delay: 200 * time.Millisecond})
+	defer ts.Close()
+	code, _, stderr := runCLI(t, ts.URL, `{"target": 1}`, "optimize", "heat", "--goal", "-", "--timeout", "20ms")
+	if code != exitTransport {
+		t.Errorf("exit %d, want %d; stderr: %s", code, exitTransport, stderr)
+	}
+}
+
+func TestDecodeSuggestion(t *testing.T) {
+	for raw, want := range map[string]string{
+		`{"params": {"dt": 1}, "objective": 2}`: `{"dt": 1}`,
+		`{"dt": 1, "steps": 2}`:                 `{"dt": 1, "steps": 2}`,
+	} {
+		sug, err := decodeSuggestion(json.RawMessage(raw))
+		if err != nil || string(sug.Params) != want {
+			t.Errorf("decodeSuggestion(%s) = %s, %v; want %s", raw, sug.Params, err, want)
+		}
+	}
+	if _, err := decodeSuggestion(json.RawMessage(`{"params": [1]}`)); err == nil {
+		t.Error("array params accepted")
+	}
+}
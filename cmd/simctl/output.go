@@ -0,0 +1,633 @@
+// output.go
+// Formatter layer shared by all subcommands: every structured result is
+// rendered here as a table, JSON, CSV or YAML according to --output.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Output formats accepted by --output.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+	outputYAML  = "yaml"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputCSV, outputYAML}
+
+// outputFlag is the --output value; it rejects unknown formats at parse time.
+type outputFlag string
+
+func (f *outputFlag) String() string { return string(*f) }
+
+func (f *outputFlag) Set(v string) error {
+	for _, name := range outputFormats {
+		if v == name {
+			*f = outputFlag(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (want %s)", v, strings.Join(outputFormats, ", "))
+}
+
+// jsonFlag is --json, kept as shorthand for --output json.
+type jsonFlag struct{ f *outputFlag }
+
+func (j jsonFlag) String() string {
+	if j.f != nil && *j.f == outputJSON {
+		return "true"
+	}
+	return "false"
+}
+
+func (j jsonFlag) Set(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	if on {
+		*j.f = outputJSON
+	} else if *j.f == outputJSON {
+		*j.f = outputTable
+	}
+	return nil
+}
+
+func (jsonFlag) IsBoolFlag() bool { return true }
+
+// jsonOutput reports whether results and errors should be machine-readable
+// JSON.
+func (e *env) jsonOutput() bool { return e.output == outputJSON }
+
+// emit renders v, a command's structured result, in the selected format.
+// JSON and YAML follow v's JSON encoding field for field, so their shape is
+// stable. CSV and, for list results, tables have one row per element and
+// one column per field, nested objects flattened to dotted names; --columns
+// picks and orders those columns. Commands whose table view is a sentence
+// rather than rows pass human, which is used unless --columns is given.
+func (e *env) emit(v any, human func(w io.Writer)) error {
+	switch e.output {
+	case outputJSON:
+		return writeJSON(e.stdout, v)
+	case outputYAML:
+		n, err := toNode(v)
+		if err != nil {
+			return err
+		}
+		return writeYAML(e.stdout, n)
+	case outputTable:
+		if human != nil && e.columns == "" {
+			human(e.stdout)
+			return nil
+		}
+	}
+	cols, rows, err := e.tabulate(v)
+	if err != nil || len(cols) == 0 {
+		return err
+	}
+	if e.output == outputCSV {
+		return writeCSV(e.stdout, cols, rows)
+	}
+	writeTable(e.stdout, cols, rows, outputWidth(e.stdout))
+	return nil
+}
+
+// writeJSON writes v as indented JSON followed by a newline.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// object is a JSON object with its keys in document order, so tables, CSV
+// and YAML list fields in the order the JSON encoding does.
+type object []member
+
+type member struct {
+	key   string
+	value any // object, []any, string, json.Number, bool or nil
+}
+
+// toNode converts v to its JSON data model, keeping object key order.
+func toNode(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return decodeNode(dec)
+}
+
+func decodeNode(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{key: k.(string), value: v})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			v, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// tabulate flattens v into rows and applies --columns.
+func (e *env) tabulate(v any) ([]string, []map[string]string, error) {
+	n, err := toNode(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, ok := n.([]any)
+	if !ok {
+		items = []any{n}
+	}
+	var cols []string
+	seen := map[string]bool{}
+	rows := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		row := map[string]string{}
+		flatten(row, &cols, seen, "", item)
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		// An empty list still gets its header, from the element type.
+		cols = typeColumns(reflect.TypeOf(v))
+		for _, c := range cols {
+			seen[c] = true
+		}
+	}
+	return e.pickColumns(cols, seen, rows)
+}
+
+// pickColumns applies --columns to cols, the columns available in rows.
+func (e *env) pickColumns(cols []string, seen map[string]bool, rows []map[string]string) ([]string, []map[string]string, error) {
+	if e.columns == "" {
+		return cols, rows, nil
+	}
+	var picked []string
+	for _, c := range strings.Split(e.columns, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !seen[c] && len(cols) > 0 {
+			sort.Strings(cols)
+			return nil, nil, usagef("unknown column %q (available: %s)", c, strings.Join(cols, ", "))
+		}
+		picked = append(picked, c)
+	}
+	return picked, rows, nil
+}
+
+// typeColumns lists the flattened column names of t's JSON encoding, for
+// slices the element's, naming nested struct fields parent.child as
+// flatten does. Map fields have no fixed keys and are left out.
+func typeColumns(t reflect.Type) []string {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var cols []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			marshals := reflect.PointerTo(ft).Implements(reflect.TypeFor[json.Marshaler]())
+			if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && !marshals {
+				walk(ft, prefix)
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			switch {
+			case ft.Kind() == reflect.Struct && !marshals:
+				walk(ft, name)
+			case ft.Kind() == reflect.Map || ft.Kind() == reflect.Interface:
+			default:
+				cols = append(cols, name)
+			}
+		}
+	}
+	walk(t, "")
+	return cols
+}
+
+// flatten stores item's fields in row, naming nested fields parent.child.
+// Arrays of scalars become comma-separated lists and anything deeper is
+// kept as compact JSON.
+func flatten(row map[string]string, cols *[]string, seen map[string]bool, prefix string, item any) {
+	obj, ok := item.(object)
+	if !ok {
+		name := prefix
+		if name == "" {
+			name = "value"
+		}
+		if !seen[name] {
+			seen[name] = true
+			*cols = append(*cols, name)
+		}
+		row[name] = cell(item)
+		return
+	}
+	for _, m := range obj {
+		name := m.key
+		if prefix != "" {
+			name = prefix + "." + m.key
+		}
+		flatten(row, cols, seen, name, m.value)
+	}
+}
+
+func cell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		parts := make([]string, len(v))
+		for i, x := range v {
+			switch x.(type) {
+			case object, []any:
+				return compactJSON(v)
+			}
+			parts[i] = cell(x)
+		}
+		return strings.Join(parts, ",")
+	}
+	return compactJSON(v)
+}
+
+func compactJSON(n any) string {
+	var b strings.Builder
+	writeNodeJSON(&b, n)
+	return b.String()
+}
+
+func writeNodeJSON(b *strings.Builder, n any) {
+	switch n := n.(type) {
+	case object:
+		b.WriteByte('{')
+		for i, m := range n {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			k, _ := json.Marshal(m.key)
+			b.Write(k)
+			b.WriteByte(':')
+			writeNodeJSON(b, m.value)
+		}
+		b.WriteByte('}')
+	case []any:
+		b.WriteByte('[')
+		for i, x := range n {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeNodeJSON(b, x)
+		}
+		b.WriteByte(']')
+	default:
+		v, _ := json.Marshal(n)
+		b.Write(v)
+	}
+}
+
+func writeCSV(w io.Writer, cols []string, rows []map[string]string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(cols)
+	rec := make([]string, len(cols))
+	for _, row := range rows {
+		for i, c := range cols {
+			rec[i] = row[c]
+		}
+		cw.Write(rec)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// streamWriter renders a sequence of updates of one type, as the watch
+// commands produce them: a JSON object per line, YAML documents separated
+// by "---", or CSV under a single header row. Table output is the
+// command's own live view, passed to write as human.
+type streamWriter struct {
+	e    *env
+	cols []string
+}
+
+func (e *env) newStream() *streamWriter { return &streamWriter{e: e} }
+
+func (s *streamWriter) write(v any, human func(w io.Writer)) error {
+	w := s.e.stdout
+	switch s.e.output {
+	case outputJSON:
+		return json.NewEncoder(w).Encode(v)
+	case outputYAML:
+		n, err := toNode(v)
+		if err != nil {
+			return err
+		}
+		io.WriteString(w, "---\n")
+		return writeYAML(w, n)
+	case outputCSV:
+		e := *s.e
+		e.columns = ""
+		dataCols, rows, err := e.tabulate(v)
+		if err != nil {
+			return err
+		}
+		header := s.cols == nil
+		if header {
+			// Columns come from the type, so omitted fields in the first
+			// update do not shift later rows.
+			cols := typeColumns(reflect.TypeOf(v))
+			if len(cols) == 0 {
+				cols = dataCols
+			}
+			seen := map[string]bool{}
+			for _, c := range cols {
+				seen[c] = true
+			}
+			if s.cols, _, err = s.e.pickColumns(cols, seen, nil); err != nil {
+				return err
+			}
+		}
+		cw := csv.NewWriter(w)
+		if header {
+			cw.Write(s.cols)
+		}
+		rec := make([]string, len(s.cols))
+		for _, row := range rows {
+			for i, c := range s.cols {
+				rec[i] = row[c]
+			}
+			cw.Write(rec)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	human(w)
+	return nil
+}
+
+// Table layout constants: the gap between columns and the narrowest a
+// column is squeezed to before the table turns into records.
+const (
+	tableGap      = 2
+	minTableWidth = 8
+)
+
+// writeTable prints rows as aligned columns under upper-cased headers. When
+// width is positive and the table does not fit, the widest columns are
+// truncated with an ellipsis; if it still does not fit, each row is printed
+// as a block of "name: value" lines instead.
+func writeTable(w io.Writer, cols []string, rows []map[string]string, width int) {
+	widths := make([]int, len(cols))
+	for i, c := range cols {
+		widths[i] = utf8.RuneCountInString(c)
+		for _, row := range rows {
+			widths[i] = max(widths[i], utf8.RuneCountInString(row[c]))
+		}
+	}
+	if width > 0 && !fitColumns(widths, width) {
+		writeRecords(w, cols, rows)
+		return
+	}
+	var b strings.Builder
+	line := func(cells []string) {
+		b.Reset()
+		for i, s := range cells {
+			s = truncate(s, widths[i])
+			b.WriteString(s)
+			if i < len(cells)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(s)+tableGap))
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+	}
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = strings.ToUpper(c)
+	}
+	line(headers)
+	cells := make([]string, len(cols))
+	for _, row := range rows {
+		for i, c := range cols {
+			cells[i] = row[c]
+		}
+		line(cells)
+	}
+}
+
+// fitColumns narrows the widest columns until the table fits in width,
+// reporting false if it cannot without going below minTableWidth.
+func fitColumns(widths []int, width int) bool {
+	total := func() int {
+		n := tableGap * (len(widths) - 1)
+		for _, w := range widths {
+			n += w
+		}
+		return n
+	}
+	for total() > width {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minTableWidth {
+			return false
+		}
+		widths[widest]--
+	}
+	return true
+}
+
+func writeRecords(w io.Writer, cols []string, rows []map[string]string) {
+	width := 0
+	for _, c := range cols {
+		width = max(width, len(c))
+	}
+	for i, row := range rows {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		for _, c := range cols {
+			fmt.Fprintf(w, "%-*s  %s\n", width+1, c+":", row[c])
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// outputWidth is the width tables must fit in: $COLUMNS when set, else the
+// terminal's width, else unlimited (0) for pipes and files.
+func outputWidth(w io.Writer) int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if isTerminal(w) {
+		return terminalWidth(w)
+	}
+	return 0
+}
+
+// writeYAML writes n, as produced by toNode, as a YAML document.
+func writeYAML(w io.Writer, n any) error {
+	var b strings.Builder
+	switch n := n.(type) {
+	case object:
+		if len(n) == 0 {
+			b.WriteString("{}\n")
+		}
+		yamlObject(&b, n, 0)
+	case []any:
+		if len(n) == 0 {
+			b.WriteString("[]\n")
+		}
+		yamlArray(&b, n, 0)
+	default:
+		b.WriteString(yamlScalar(n) + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func yamlObject(b *strings.Builder, obj object, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for _, m := range obj {
+		b.WriteString(pad + yamlString(m.key) + ":")
+		yamlValue(b, m.value, indent+1)
+	}
+}
+
+func yamlArray(b *strings.Builder, arr []any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for _, x := range arr {
+		b.WriteString(pad + "-")
+		if obj, ok := x.(object); ok && len(obj) > 0 {
+			// The first field shares the dash's line.
+			var inner strings.Builder
+			yamlObject(&inner, obj, indent+1)
+			b.WriteString(" " + strings.TrimLeft(inner.String(), " "))
+			continue
+		}
+		yamlValue(b, x, indent+1)
+	}
+}
+
+// yamlValue writes the value after a "key:" or "-" already on the line.
+func yamlValue(b *strings.Builder, v any, indent int) {
+	switch v := v.(type) {
+	case object:
+		if len(v) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+		b.WriteString("\n")
+		yamlObject(b, v, indent)
+	case []any:
+		if len(v) == 0 {
+			b.WriteString(" []\n")
+			return
+		}
+		b.WriteString("\n")
+		yamlArray(b, v, indent)
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return yamlString(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return compactJSON(v)
+}
+
+// yamlString quotes s when a YAML parser would otherwise read it as
+// something other than the same plain string.
+func yamlString(s string) string {
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n\t\\") ||
+		strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
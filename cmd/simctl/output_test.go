@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type outputRow struct {
+	Name  string         `json:"name"`
+	Size  int            `json:"size"`
+	Tags  []string       `json:"tags,omitempty"`
+	Stats map[string]any `json:"stats,omitempty"`
+}
+
+var outputRows = []outputRow{
+	{Name: "heat_1.json", Size: 2048, Tags: []string{"demo", "ci"}, Stats: map[string]any{"max": 99.5}},
+	{Name: "nbody_2.json", Size: 10},
+}
+
+func TestEmitFormats(t *testing.T) {
+	t.Setenv("COLUMNS", "")
+	tests := []struct {
+		output  string
+		columns string
+		want    string
+	}{
+		{outputTable, "", "NAME          SIZE  TAGS     STATS.MAX\nheat_1.json   2048  demo,ci  99.5\nnbody_2.json  10\n"},
+		{outputTable, "size,name", "SIZE  NAME\n2048  heat_1.json\n10    nbody_2.json\n"},
+		{outputCSV, "", "name,size,tags,stats.max\nheat_1.json,2048,\"demo,ci\",99.5\nnbody_2.json,10,,\n"},
+		{outputCSV, "name", "name\nheat_1.json\nnbody_2.json\n"},
+		{outputJSON, "", "[\n  {\n    \"name\": \"heat_1.json\",\n    \"size\": 2048,\n    \"tags\": [\n      \"demo\",\n      \"ci\"\n    ],\n    \"stats\": {\n      \"max\": 99.5\n    }\n  },\n  {\n    \"name\": \"nbody_2.json\",\n    \"size\": 10\n  }\n]\n"},
+		{outputYAML, "", "- name: heat_1.json\n  size: 2048\n  tags:\n    - demo\n    - ci\n  stats:\n    max: 99.5\n- name: nbody_2.json\n  size: 10\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := &env{output: outputFlag(tt.output), columns: tt.columns, stdout: &out}
+		if err := e.emit(outputRows, nil); err != nil {
+			t.Errorf("%s %q: %v", tt.output, tt.columns, err)
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s %q:\n%s\nwant:\n%s", tt.output, tt.columns, out.String(), tt.want)
+		}
+	}
+}
+
+func TestEmitHumanAndColumns(t *testing.T) {
+	human := func(w io.Writer) { io.WriteString(w, "deleted nbody_2.json\n") }
+	tests := []struct {
+		output  string
+		columns string
+		want    string
+	}{
+		{outputTable, "", "deleted nbody_2.json\n"},
+		{outputTable, "name", "NAME\nnbody_2.json\n"},
+		{outputCSV, "", "name,size\nnbody_2.json,10\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := &env{output: outputFlag(tt.output), columns: tt.columns, stdout: &out}
+		if err := e.emit(outputRows[1], human); err != nil || out.String() != tt.want {
+			t.Errorf("%s %q: %q (%v), want %q", tt.output, tt.columns, out.String(), err, tt.want)
+		}
+	}
+
+	e := &env{output: outputTable, columns: "nope", stdout: io.Discard}
+	if err := e.emit(outputRows, nil); exitCode(err) != exitUsage || !strings.Contains(err.Error(), "available: name, size, stats.max, tags") {
+		t.Errorf("unknown column: %v", err)
+	}
+}
+
+func TestWriteTableNarrow(t *testing.T) {
+	cols := []string{"filename", "type"}
+	rows := []map[string]string{{"filename": "heat_1715003456_results.json", "type": "heat"}}
+
+	var out bytes.Buffer
+	writeTable(&out, cols, rows, 24)
+	if want := "FILENAME            TYPE\nheat_1715003456_r…  heat\n"; out.String() != want {
+		t.Errorf("truncated table:\n%q\nwant\n%q", out.String(), want)
+	}
+
+	out.Reset()
+	writeTable(&out, cols, rows, 12)
+	if want := "filename:  heat_1715003456_results.json\ntype:      heat\n"; out.String() != want {
+		t.Errorf("record fallback:\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	for in, want := range map[string]string{
+		"heat":                 "heat",
+		"":                     `""`,
+		"yes":                  `"yes"`,
+		"12":                   `"12"`,
+		"2026-10-01T12:00:00Z": `"2026-10-01T12:00:00Z"`,
+		"- x":                  `"- x"`,
+		"a b":                  "a b",
+	} {
+		if got := yamlString(in); got != want {
+			t.Errorf("yamlString(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestOutputFlag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusOK, []map[string]any{{"filename": "heat_1.json", "type": "heat", "size": 1}})
+	}))
+	defer ts.Close()
+
+	code, stdout, _ := runCLI(t, ts.URL, "", "results", "list", "--output", "csv", "--columns", "filename,size")
+	if code != exitOK || !strings.HasPrefix(stdout, "filename,size\nheat_1.json,1\n") {
+		t.Errorf("csv: exit %d, stdout %q", code, stdout)
+	}
+	code, stdout, _ = runCLI(t, ts.URL, "", "--json", "results", "list")
+	if code != exitOK || !strings.HasPrefix(stdout, "[\n  {\n    \"filename\"") {
+		t.Errorf("--json alias: exit %d, stdout %q", code, stdout)
+	}
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusOK, []any{})
+	}))
+	defer empty.Close()
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--output", "csv"}, "filename,type,size,modified,tags\n"},
+		{[]string{"--output", "csv", "--columns", "size,filename"}, "size,filename\n"},
+		{[]string{"--output", "table"}, "FILENAME  TYPE  SIZE  MODIFIED  TAGS\n"},
+	} {
+		code, stdout, _ = runCLI(t, empty.URL, "", append([]string{"results", "list"}, tc.args...)...)
+		if code != exitOK || stdout != tc.want {
+			t.Errorf("empty list %q: exit %d, stdout %q", tc.args, code, stdout)
+		}
+	}
+	if code, _, _ = runCLI(t, empty.URL, "", "results", "list", "--output", "csv", "--columns", "nope"); code != exitUsage {
+		t.Errorf("empty list, unknown column: exit %d, want %d", code, exitUsage)
+	}
+
+	if code, _, _ = runCLI(t, ts.URL, "", "results", "list", "--output", "xml"); code != exitUsage {
+		t.Errorf("unknown format: exit %d, want %d", code, exitUsage)
+	}
+}
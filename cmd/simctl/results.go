@@ -0,0 +1,584 @@
+// results.go
+// simctl results list|get|download|delete against /api/results.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var resultsCmd = &command{
+	name:    "results",
+	summary: "list, inspect, download and delete stored results",
+	children: []*command{
+		{name: "list", summary: "list stored results", run: runResultsList, examples: []example{
+			{"heat results from the last day", "simctl results list --type heat --since 24h"},
+			{"names and sizes as CSV", "simctl results list --output csv --columns filename,size"},
+		}},
+		{name: "get", summary: "print a result's metadata", run: runResultsGet, examples: []example{
+			{"metadata as JSON", "simctl results get heat_1715003456.json --json"},
+		}},
+		{name: "download", summary: "download a result file", run: runResultsDownload, examples: []example{
+			{"download, resuming a partial download if there is one", "simctl results download heat_1715003456.json -o run.json"},
+			{"stream to another tool", "simctl results download heat_1715003456.json -o - | jq .summary"},
+		}},
+		{name: "delete", summary: "delete a result", run: runResultsDelete, examples: []example{
+			{"delete without prompting, e.g. in scripts", "simctl results delete heat_1715003456.json --yes"},
+		}},
+	},
+}
+
+// resultEntry is one row of the /api/results listing.
+type resultEntry struct {
+	Filename string    `json:"filename"`
+	Type     string    `json:"type,omitempty"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+func runResultsList(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl results list [--type T] [--since T] [--until T] [--tags a,b]")
+	simType := fs.String("type", "", "only results of this simulation type")
+	since := fs.String("since", "", "only results modified after this RFC 3339 time or duration ago (e.g. 24h)")
+	until := fs.String("until", "", "only results modified before this RFC 3339 time or duration ago")
+	tags := fs.String("tags", "", "only results carrying all of these comma-separated tags")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected arguments: %q", rest)
+	}
+
+	q := url.Values{}
+	if *simType != "" {
+		q.Set("type", *simType)
+	}
+	for name, v := range map[string]string{"since": *since, "until": *until} {
+		if v == "" {
+			continue
+		}
+		t, err := parseTimeArg(v, time.Now())
+		if err != nil {
+			return usagef("--%s: %v", name, err)
+		}
+		q.Set(name, t.UTC().Format(time.RFC3339))
+	}
+	if *tags != "" {
+		q.Set("tags", *tags)
+	}
+
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+	entries, err := listResults(ctx, c, q)
+	if err != nil {
+		return err
+	}
+	return e.emit(entries, nil)
+}
+
+// listResults fetches the listing, accepting either a bare array or one
+// wrapped as {"results": [...]}.
+func listResults(ctx context.Context, c *client, q url.Values) ([]resultEntry, error) {
+	var raw json.RawMessage
+	if err := c.getJSON(ctx, "/api/results", q, &raw); err != nil {
+		return nil, err
+	}
+	var entries []resultEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		var wrapped struct {
+			Results []resultEntry `json:"results"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, fmt.Errorf("decoding results listing: %w", err)
+		}
+		entries = wrapped.Results
+	}
+	if entries == nil {
+		entries = []resultEntry{}
+	}
+	return entries, nil
+}
+
+// parseTimeArg accepts an RFC 3339 timestamp, a date, or a duration
+// meaning that long before now.
+func parseTimeArg(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time, a date nor a duration", s)
+}
+
+func runResultsGet(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl results get NAME")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("results get takes exactly one result name")
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+	var meta map[string]any
+	if err := c.getJSON(ctx, resultPath(rest[0])+"/metadata", nil, &meta); err != nil {
+		return err
+	}
+	return e.emit(meta, func(w io.Writer) {
+		keys := make([]string, 0, len(meta))
+		for k := range meta {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, k := range keys {
+			v := meta[k]
+			if b, ok := v.(map[string]any); ok {
+				j, _ := json.Marshal(b)
+				v = string(j)
+			}
+			fmt.Fprintf(tw, "%s:\t%v\n", k, v)
+		}
+		tw.Flush()
+	})
+}
+
+func resultPath(name string) string {
+	return "/api/results/" + url.PathEscape(name)
+}
+
+type downloadOutput struct {
+	Filename string `json:"filename"`
+	Path     string `json:"path"`
+	Bytes    int64  `json:"bytes"`
+	Resumed  int64  `json:"resumed_from,omitempty"`
+	SHA256   string `json:"sha256"`
+	Verified bool   `json:"verified"`
+}
+
+func runResultsDownload(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl results download NAME [-o PATH|-]")
+	out := fs.String("o", "", "output path, or - for stdout (default: NAME in the current directory)")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("results download takes exactly one result name")
+	}
+	name := rest[0]
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		return streamResult(ctx, c, name, e.stdout)
+	}
+
+	dest := *out
+	if dest == "" {
+		dest = filepath.Base(name)
+	}
+	res, err := downloadResult(ctx, c, name, dest, e.stderr)
+	if err != nil {
+		return err
+	}
+	return e.emit(res, func(w io.Writer) {
+		state := "no checksum from server"
+		if res.Verified {
+			state = "sha256 verified"
+		}
+		fmt.Fprintf(w, "downloaded %s to %s (%s, %s)\n", name, res.Path, humanBytes(res.Bytes), state)
+	})
+}
+
+// streamResult copies name to w in one pass, without resume support.
+func streamResult(ctx context.Context, c *client, name string, w io.Writer) error {
+	resp, err := c.send(ctx, resultRequest(name, 0, ""))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := transfer(name, w, h, resp, 0, nil); err != nil {
+		return err
+	}
+	return checkDigest(name, checksumHeader(resp.Header), hex.EncodeToString(h.Sum(nil)))
+}
+
+// downloadResult fetches name into dest through dest+".part", resuming a
+// part file left by an earlier attempt. Resuming is only attempted when
+// the validator saved beside the part file lets the server confirm, via
+// If-Range, that the result has not changed since; otherwise the download
+// starts over. The part file is renamed into place only once the checksum
+// (when the server provides one) matches.
+func downloadResult(ctx context.Context, c *client, name, dest string, progress io.Writer) (*downloadOutput, error) {
+	part := dest + ".part"
+	metaPath := part + ".meta"
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	offset, err := io.Copy(h, f)
+	if err != nil {
+		return nil, fmt.Errorf("reading partial download %s: %w", part, err)
+	}
+	v := readValidator(metaPath)
+	if offset > 0 && v.ifRange() == "" {
+		offset = 0
+	}
+
+	var (
+		resp     *http.Response
+		expected string
+		resumed  int64
+	)
+	for attempt := 0; ; attempt++ {
+		if offset == 0 {
+			if err := restartPart(f, h); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = c.send(ctx, resultRequest(name, offset, v.ifRange()))
+		var ae *apiError
+		if errors.As(err, &ae) && ae.Status == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+			// If-Range matched and nothing is left to fetch; ask for the
+			// headers alone so the part file can still be verified.
+			resp, err = c.send(ctx, request{Method: http.MethodHead, Path: resultPath(name)})
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+			expected = checksumHeader(resp.Header)
+			resp, resumed = nil, offset
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusPartialContent {
+			if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset || offset == 0 {
+				resp.Body.Close()
+				if attempt > 0 {
+					return nil, fmt.Errorf("server sent an unexpected range %q for %s", resp.Header.Get("Content-Range"), name)
+				}
+				offset = 0
+				continue
+			}
+			resumed = offset
+		} else {
+			if offset > 0 {
+				// The validator no longer matches (or Range is unsupported):
+				// the whole file follows, so discard the stale part first.
+				offset = 0
+				if err := restartPart(f, h); err != nil {
+					resp.Body.Close()
+					return nil, err
+				}
+			}
+			if err := writeValidator(metaPath, validatorFrom(resp.Header)); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+		expected = checksumHeader(resp.Header)
+		break
+	}
+
+	written := offset
+	if resp != nil {
+		n, err := transfer(name, f, h, resp, offset, progress)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		written += n
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if err := checkDigest(name, expected, digest); err != nil {
+		os.Remove(part)
+		os.Remove(metaPath)
+		return nil, err
+	}
+	if err := os.Rename(part, dest); err != nil {
+		return nil, err
+	}
+	os.Remove(metaPath)
+	return &downloadOutput{
+		Filename: name,
+		Path:     dest,
+		Bytes:    written,
+		Resumed:  resumed,
+		SHA256:   digest,
+		Verified: expected != "",
+	}, nil
+}
+
+func resultRequest(name string, offset int64, ifRange string) request {
+	req := request{Method: http.MethodGet, Path: resultPath(name), Header: http.Header{}}
+	req.Header.Set("Accept", "*/*")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", ifRange)
+	}
+	return req
+}
+
+// restartPart empties the part file and the running hash.
+func restartPart(f *os.File, h hash.Hash) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h.Reset()
+	return nil
+}
+
+// contentRangeStart returns the first byte position of a
+// "bytes start-end/size" Content-Range header.
+func contentRangeStart(v string) (int64, bool) {
+	spec, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	return n, err == nil
+}
+
+// validator identifies the version of a result a part file belongs to.
+type validator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func validatorFrom(h http.Header) validator {
+	return validator{ETag: h.Get("ETag"), LastModified: h.Get("Last-Modified")}
+}
+
+// ifRange returns the If-Range value to send, or "" when the part file
+// cannot be validated. Weak ETags are not allowed in If-Range.
+func (v validator) ifRange() string {
+	if v.ETag != "" && !strings.HasPrefix(v.ETag, "W/") {
+		return v.ETag
+	}
+	return v.LastModified
+}
+
+func readValidator(path string) validator {
+	var v validator
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &v)
+	}
+	return v
+}
+
+func writeValidator(path string, v validator) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// transfer copies resp's body into w and h, drawing a progress bar on
+// progress. Failures reading the body are transport errors; failures
+// writing w (a full disk, say) are local and reported as such.
+func transfer(name string, w io.Writer, h hash.Hash, resp *http.Response, start int64, progress io.Writer) (int64, error) {
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = start + resp.ContentLength
+	}
+	bar := newProgressBar(progress, start, total)
+	body := &bodyReader{r: resp.Body}
+	n, err := io.Copy(io.MultiWriter(w, h, bar), body)
+	bar.finish()
+	switch {
+	case body.err != nil:
+		return n, &transportError{Op: "downloading " + name, Err: body.err}
+	case err != nil:
+		return n, fmt.Errorf("writing %s: %w", name, err)
+	case resp.ContentLength >= 0 && n != resp.ContentLength:
+		return n, &transportError{Op: "downloading " + name, Err: io.ErrUnexpectedEOF}
+	}
+	return n, nil
+}
+
+// bodyReader remembers the first read error so transfer can tell it apart
+// from a write error surfacing through the same io.Copy.
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// checksumHeader extracts the hex SHA-256 the server sends as X-Checksum
+// ("sha256=<hex>" or bare hex) or X-Checksum-SHA256.
+func checksumHeader(h http.Header) string {
+	if v := h.Get("X-Checksum-SHA256"); v != "" {
+		return strings.ToLower(v)
+	}
+	v := h.Get("X-Checksum")
+	if algo, sum, ok := strings.Cut(v, "="); ok {
+		if !strings.EqualFold(algo, "sha256") {
+			return ""
+		}
+		v = sum
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+func checkDigest(name, expected, got string) error {
+	if expected != "" && expected != got {
+		return fmt.Errorf("checksum mismatch for %s: server says %s, got %s", name, expected, got)
+	}
+	return nil
+}
+
+// progressBar renders transfer progress on a terminal and is a no-op
+// writer anywhere else.
+type progressBar struct {
+	w        io.Writer
+	n, total int64
+	last     time.Time
+}
+
+func newProgressBar(w io.Writer, start, total int64) *progressBar {
+	if w != nil && !isTerminal(w) {
+		w = nil
+	}
+	return &progressBar{w: w, n: start, total: total}
+}
+
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	if p.w != nil && time.Since(p.last) > 100*time.Millisecond {
+		p.last = time.Now()
+		p.draw()
+	}
+	return len(b), nil
+}
+
+func (p *progressBar) draw() {
+	if p.total <= 0 {
+		fmt.Fprintf(p.w, "\r%s", humanBytes(p.n))
+		return
+	}
+	const width = 30
+	frac := float64(p.n) / float64(p.total)
+	filled := int(frac * width)
+	fmt.Fprintf(p.w, "\r[%s%s] %3.0f%% %s / %s", strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		frac*100, humanBytes(p.n), humanBytes(p.total))
+}
+
+func (p *progressBar) finish() {
+	if p.w != nil {
+		p.draw()
+		fmt.Fprintln(p.w)
+	}
+}
+
+func runResultsDelete(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl results delete NAME [--yes]")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("results delete takes exactly one result name")
+	}
+	name := rest[0]
+	if !*yes {
+		ok, err := confirm(e, fmt.Sprintf("Delete result %s?", name))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s not deleted", name)
+		}
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+	if err := c.doJSON(ctx, request{Method: http.MethodDelete, Path: resultPath(name)}, nil); err != nil {
+		return err
+	}
+	return e.emit(map[string]any{"filename": name, "deleted": true}, func(w io.Writer) {
+		fmt.Fprintf(w, "deleted %s\n", name)
+	})
+}
+
+// confirm asks a yes/no question on stderr. It refuses to guess when stdin
+// is not interactive, so scripts must pass --yes explicitly.
+func confirm(e *env, question string) (bool, error) {
+	if !isTerminal(e.stdin) {
+		return false, usagef("refusing to prompt on non-interactive stdin; pass --yes")
+	}
+	fmt.Fprintf(e.stderr, "%s [y/N] ", question)
+	line, err := bufio.NewReader(e.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
+
+// humanBytes formats n using binary units.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resultServer serves one result file with ETag, Range and If-Range
+// support via http.ServeContent, and records each request's Range and
+// If-Range headers.
+type resultServer struct {
+	mu       sync.Mutex
+	data     []byte
+	etag     string
+	checksum string // overrides the X-Checksum header when set
+	ranges   []string
+	ifRanges []string
+}
+
+func (s *resultServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, etag := s.data, s.etag
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.ifRanges = append(s.ifRanges, r.Header.Get("If-Range"))
+	sum := s.checksum
+	s.mu.Unlock()
+	if r.URL.Path != "/api/results/heat_1.json" {
+		writeJSONResponse(w, http.StatusNotFound, map[string]any{
+			"error": map[string]any{"code": "result_not_found", "message": "no such result"},
+		})
+		return
+	}
+	if sum == "" {
+		d := sha256.Sum256(data)
+		sum = hex.EncodeToString(d[:])
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Checksum", "sha256="+sum)
+	http.ServeContent(w, r, "heat_1.json", time.Time{}, bytes.NewReader(data))
+}
+
+func payload(n int, fill byte) []byte {
+	b := bytes.Repeat([]byte{fill}, n)
+	for i := range b {
+		b[i] += byte(i % 7)
+	}
+	return b
+}
+
+func writePart(t *testing.T, dest string, data []byte, etag string) {
+	t.Helper()
+	if err := os.WriteFile(dest+".part", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if etag != "" {
+		if err := writeValidator(dest+".part.meta", validator{ETag: etag}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResultsDownload(t *testing.T) {
+	full := payload(9000, 'a')
+	tests := []struct {
+		name       string
+		part       []byte // existing part file, nil for none
+		partETag   string // validator saved beside the part file
+		serverETag string
+		checksum   string
+		wantCode   int
+		wantRange  string
+		wantResume bool
+	}{
+		{name: "fresh", serverETag: `"v1"`, wantCode: exitOK},
+		{name: "resume", part: full[:4000], partETag: `"v1"`, serverETag: `"v1"`,
+			wantCode: exitOK, wantRange: "bytes=4000-", wantResume: true},
+		{name: "changed on server", part: payload(4000, 'z'), partETag: `"v0"`, serverETag: `"v1"`,
+			wantCode: exitOK, wantRange: "bytes=4000-"},
+		{name: "no validator restarts", part: payload(4000, 'z'), serverETag: `"v1"`, wantCode: exitOK},
+		{name: "stale tail longer than file", part: payload(12000, 'z'), partETag: `"v0"`, serverETag: `"v1"`,
+			wantCode: exitOK, wantRange: "bytes=12000-"},
+		{name: "checksum mismatch", serverETag: `"v1"`, checksum: strings.Repeat("0", 64), wantCode: exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := &resultServer{data: full, etag: tt.serverETag, checksum: tt.checksum}
+			srv := httptest.NewServer(rs)
+			defer srv.Close()
+			dest := filepath.Join(t.TempDir(), "out.json")
+			if tt.part != nil {
+				writePart(t, dest, tt.part, tt.partETag)
+			}
+
+			code, stdout, stderr := runCLI(t, srv.URL, "", "results", "download", "heat_1.json", "-o", dest, "--json")
+			if code != tt.wantCode {
+				t.Fatalf("exit %d, want %d; stderr: %s", code, tt.wantCode, stderr)
+			}
+			if rs.ranges[0] != tt.wantRange {
+				t.Errorf("first request Range = %q, want %q", rs.ranges[0], tt.wantRange)
+			}
+			if tt.wantRange != "" && rs.ifRanges[0] != tt.partETag {
+				t.Errorf("If-Range = %q, want %q", rs.ifRanges[0], tt.partETag)
+			}
+			if code != exitOK {
+				if _, err := os.Stat(dest + ".part"); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("part file left behind after failure: %v", err)
+				}
+				return
+			}
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, full) {
+				t.Errorf("downloaded %d bytes that differ from the %d served", len(got), len(full))
+			}
+			if strings.Contains(stdout, `"resumed_from"`) != tt.wantResume {
+				t.Errorf("resumed = %v, want %v; output: %s", !tt.wantResume, tt.wantResume, stdout)
+			}
+			for _, p := range []string{dest + ".part", dest + ".part.meta"} {
+				if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s left behind: %v", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestResultsDownloadInterruptedRestartTruncatesPart(t *testing.T) {
+	full := payload(9000, 'a')
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ignore the Range and send half of a full response before dropping
+		// the connection.
+		w.Header().Set("ETag", `"v2"`)
+		w.Header().Set("Content-Length", fmt.Sprint(len(full)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(full[:3000])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "out.json")
+	writePart(t, dest, payload(9000, 'z'), `"v1"`)
+
+	code, _, stderr := runCLI(t, srv.URL, "", "results", "download", "heat_1.json", "-o", dest)
+	if code != exitTransport {
+		t.Fatalf("exit %d, want %d; stderr: %s", code, exitTransport, stderr)
+	}
+	got, err := os.ReadFile(dest + ".part")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, full[:3000]) {
+		t.Errorf("part file holds %d bytes, want exactly the 3000 received after the restart", len(got))
+	}
+	if v := readValidator(dest + ".part.meta"); v.ETag != `"v2"` {
+		t.Errorf("saved validator %+v, want the restarted response's ETag", v)
+	}
+}
+
+func TestResultsDownloadContentRangeMismatch(t *testing.T) {
+	full := payload(5000, 'a')
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") != "" {
+			// Claims partial content but starts at the wrong offset.
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-99/%d", len(full)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(full[:100])
+			return
+		}
+		w.Write(full)
+	}))
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "out.json")
+	writePart(t, dest, full[:2000], `"v1"`)
+
+	if code, _, stderr := runCLI(t, srv.URL, "", "results", "download", "heat_1.json", "-o", dest); code != exitOK {
+		t.Fatalf("exit %d; stderr: %s", code, stderr)
+	}
+	if len(requests) != 2 || requests[1] != "" {
+		t.Errorf("requests %q, want a ranged attempt followed by a full restart", requests)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, full) {
+		t.Errorf("downloaded file differs from the served one")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("no space left on device") }
+
+func TestTransferSeparatesWriteErrors(t *testing.T) {
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader("abc")), ContentLength: 3}
+	_, err := transfer("heat_1.json", failingWriter{}, sha256.New(), resp, 0, nil)
+	if err == nil {
+		t.Fatal("transfer succeeded writing to a failing destination")
+	}
+	if code := exitCode(err); code != exitFailure {
+		t.Errorf("local write error maps to exit %d, want %d (%v)", code, exitFailure, err)
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   int64
+		wantOK bool
+	}{
+		{"bytes 4000-8999/9000", 4000, true},
+		{"bytes 0-0/1", 0, true},
+		{"bytes */9000", 0, false},
+		{"items 1-2/3", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := contentRangeStart(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("contentRangeStart(%q) = %d, %v; want %d, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestResultsListAndGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/results":
+			if got := r.URL.Query().Get("type"); got != "heat" {
+				t.Errorf("type filter = %q, want heat", got)
+			}
+			writeJSONResponse(w, http.StatusOK, map[string]any{"results": []map[string]any{
+				{"filename": "heat_1.json", "type": "heat", "size": 2048, "modified": "2026-10-01T12:00:00Z", "tags": []string{"demo"}},
+			}})
+		case "/api/results/heat_1.json/metadata":
+			writeJSONResponse(w, http.StatusOK, map[string]any{"filename": "heat_1.json", "size": 2048})
+		default:
+			writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "result not found"})
+		}
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := runCLI(t, srv.URL, "", "results", "list", "--type", "heat")
+	if code != exitOK || !strings.Contains(stdout, "heat_1.json") || !strings.Contains(stdout, "2048") {
+		t.Errorf("list: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	code, stdout, _ = runCLI(t, srv.URL, "", "results", "get", "heat_1.json")
+	if code != exitOK || !strings.Contains(stdout, "size:") {
+		t.Errorf("get: exit %d, stdout %q", code, stdout)
+	}
+	if code, _, _ = runCLI(t, srv.URL, "", "results", "get", "missing.json"); code != exitNotFound {
+		t.Errorf("get missing: exit %d, want %d", code, exitNotFound)
+	}
+}
+
+func TestResultsDelete(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("method %s, want DELETE", r.Method)
+		}
+		if r.URL.Path != "/api/results/heat_1.json" {
+			writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "result not found"})
+			return
+		}
+		deleted = append(deleted, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if code, _, stderr := runCLI(t, srv.URL, "", "results", "delete", "heat_1.json"); code != exitUsage {
+		t.Errorf("delete without --yes on non-interactive stdin: exit %d, want %d; %s", code, exitUsage, stderr)
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("deleted without confirmation: %v", deleted)
+	}
+	if code, _, _ := runCLI(t, srv.URL, "", "results", "delete", "heat_1.json", "--yes"); code != exitOK {
+		t.Errorf("delete --yes: exit %d", code)
+	}
+	if code, _, _ := runCLI(t, srv.URL, "", "results", "delete", "missing.json", "--yes"); code != exitNotFound {
+		t.Errorf("delete missing: exit %d, want %d", code, exitNotFound)
+	}
+}
+
+func TestIsTerminalDevNull(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Errorf("isTerminal(%s) = true", os.DevNull)
+	}
+}
@@ -0,0 +1,174 @@
+// simulate.go
+// simctl simulate heat|nbody: submit a parameter file to /api/simulate.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+)
+
+// simTypes are the simulation types the API serves, in display order.
+var simTypes = []string{"heat", "nbody"}
+
+var simulateCmd = &command{
+	name:     "simulate",
+	summary:  "run a simulation from a parameter file",
+	children: simTypeCommands("%s simulation", runSimulate),
+	examples: []example{
+		{"run and wait for the result", "simctl simulate heat --params params.json"},
+		{"edit parameters on the fly and follow the job", "jq '.steps = 500' params.json | simctl simulate nbody --params - --wait"},
+		{"submit in the background and watch later", "simctl simulate heat --params params.json --async"},
+	},
+}
+
+// simTypeCommands builds one child command per simulation type.
+func simTypeCommands(summary string, run func(ctx context.Context, e *env, simType string, args []string) error) []*command {
+	var cmds []*command
+	for _, t := range simTypes {
+		cmds = append(cmds, &command{
+			name:    t,
+			summary: fmt.Sprintf(summary, t),
+			run: func(ctx context.Context, e *env, args []string) error {
+				return run(ctx, e, t, args)
+			},
+		})
+	}
+	return cmds
+}
+
+// simulateResult is the synchronous simulate response.
+type simulateResult struct {
+	Filename string         `json:"filename"`
+	Summary  map[string]any `json:"summary,omitempty"`
+}
+
+// jobSubmission is the response to an async submission.
+type jobSubmission struct {
+	JobID string `json:"job_id"`
+}
+
+func runSimulate(ctx context.Context, e *env, simType string, args []string) error {
+	fs := e.flagSet("simctl simulate " + simType + " --params FILE|- [--async] [--wait]")
+	paramsPath := fs.String("params", "", "JSON parameter file, or - for stdin (required)")
+	async := fs.Bool("async", false, "submit as a background job and print its ID")
+	wait := fs.Bool("wait", false, "with --async, poll the job until it finishes (implies --async)")
+	poll := fs.Duration("poll", defaultPollInterval, "job polling interval for --wait")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected arguments: %q", rest)
+	}
+	if *paramsPath == "" {
+		return usagef("--params is required")
+	}
+	if *poll <= 0 {
+		return usagef("--poll must be positive")
+	}
+	params, err := readJSONInput(e, *paramsPath, "parameters")
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+	path := "/api/simulate/" + simType
+
+	if !*async && !*wait {
+		var raw json.RawMessage
+		if err := c.postJSON(ctx, path, nil, params, &raw); err != nil {
+			return err
+		}
+		var res simulateResult
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return fmt.Errorf("decoding simulate response: %w", err)
+		}
+		return e.emit(raw, func(w io.Writer) { printSimulateResult(w, &res) })
+	}
+
+	sub, err := submitJob(ctx, c, path, params)
+	if err != nil {
+		return err
+	}
+	if !*wait {
+		return e.emit(sub, func(w io.Writer) { fmt.Fprintln(w, sub.JobID) })
+	}
+	j, err := pollJob(ctx, c, sub.JobID, *poll, e.stderr)
+	if err != nil {
+		return err
+	}
+	if err := e.emit(j, func(w io.Writer) { printJob(w, j) }); err != nil {
+		return err
+	}
+	return j.err()
+}
+
+// submitJob posts params to path as an async job.
+func submitJob(ctx context.Context, c *client, path string, params []byte) (*jobSubmission, error) {
+	var sub jobSubmission
+	if err := c.postJSON(ctx, path, url.Values{"async": {"true"}}, params, &sub); err != nil {
+		return nil, err
+	}
+	if sub.JobID == "" {
+		return nil, fmt.Errorf("server accepted the job but returned no job_id")
+	}
+	return &sub, nil
+}
+
+// readJSONInput loads a JSON document from path, or from stdin when path
+// is "-", and checks that it parses so typos fail before a round trip.
+// what names the document in errors.
+func readJSONInput(e *env, path, what string) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "-" {
+		b, err = io.ReadAll(e.stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, usagef("reading %s: %v", what, err)
+	}
+	if !json.Valid(b) {
+		return nil, usagef("%s in %s: not valid JSON", what, displayPath(path))
+	}
+	return b, nil
+}
+
+func displayPath(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
+
+func printSimulateResult(w io.Writer, res *simulateResult) {
+	fmt.Fprintf(w, "saved %s\n", res.Filename)
+	keys := make([]string, 0, len(res.Summary))
+	for k := range res.Summary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s: %v\n", k, res.Summary[k])
+	}
+}
+
+func printJob(w io.Writer, j *job) {
+	fmt.Fprintf(w, "job %s %s\n", j.ID, j.State)
+	if j.Filename != "" {
+		fmt.Fprintf(w, "  result: %s\n", j.Filename)
+	}
+	if j.Error != "" {
+		fmt.Fprintf(w, "  error: %s\n", j.Error)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// simServer fakes /api/simulate and /api/jobs. Jobs report running on
+// their first poll and finalState afterwards.
+type simServer struct {
+	mu         sync.Mutex
+	finalState string
+	bodies     []string
+	polls      int
+}
+
+func (s *simServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/simulate/"):
+		b, _ := io.ReadAll(r.Body)
+		s.bodies = append(s.bodies, string(b))
+		var p map[string]any
+		json.Unmarshal(b, &p)
+		if dt, _ := p["dt"].(float64); dt <= 0 {
+			writeJSONResponse(w, http.StatusUnprocessableEntity, map[string]any{"error": map[string]any{
+				"code": "validation_failed", "message": "invalid parameters",
+				"details": []fieldError{{Field: "/steps", Message: "required"}, {Field: "/dt", Message: "must be > 0"}},
+			}})
+			return
+		}
+		if r.URL.Query().Get("async") == "true" {
+			writeJSONResponse(w, http.StatusAccepted, map[string]string{"job_id": "j1"})
+			return
+		}
+		simType := strings.TrimPrefix(r.URL.Path, "/api/simulate/")
+		writeJSONResponse(w, http.StatusOK, map[string]any{
+			"filename": simType + "_1.json", "summary": map[string]any{"max_temp": 99.5},
+		})
+	case r.URL.Path == "/api/jobs/j1":
+		s.polls++
+		j := job{ID: "j1", State: jobRunning}
+		if s.polls > 1 {
+			j.State = s.finalState
+			if j.State == jobSucceeded {
+				j.Filename = "heat_1.json"
+			} else {
+				j.Error = "solver diverged"
+			}
+		}
+		writeJSONResponse(w, http.StatusOK, j)
+	default:
+		writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "not found"})
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	if err := os.WriteFile(good, []byte(`{"dt":0.1,"steps":10}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		stdin      string
+		args       []string
+		finalState string
+		wantCode   int
+		wantOut    string
+		wantErr    []string
+	}{
+		{name: "sync from file", args: []string{"heat", "--params", good},
+			wantCode: exitOK, wantOut: "saved heat_1.json\n  max_temp: 99.5\n"},
+		{name: "sync from stdin", stdin: `{"dt":0.5}`, args: []string{"nbody", "--params", "-"},
+			wantCode: exitOK, wantOut: "saved nbody_1.json"},
+		{name: "validation errors listed per field", stdin: `{"dt":0}`, args: []string{"heat", "--params", "-"},
+			wantCode: exitUsage, wantErr: []string{"422", "\n  dt: must be > 0\n  steps: required\n"}},
+		{name: "invalid JSON", stdin: `{"dt":`, args: []string{"heat", "--params", "-"},
+			wantCode: exitUsage, wantErr: []string{"not valid JSON"}},
+		{name: "missing params", args: []string{"heat"}, wantCode: exitUsage, wantErr: []string{"--params is required"}},
+		{name: "async", args: []string{"heat", "--params", good, "--async"}, wantCode: exitOK, wantOut: "j1\n"},
+		{name: "wait succeeds", args: []string{"heat", "--params", good, "--wait", "--poll", "1ms"},
+			finalState: jobSucceeded, wantCode: exitOK, wantOut: "job j1 succeeded\n  result: heat_1.json\n"},
+		{name: "wait fails", args: []string{"heat", "--params", good, "--wait", "--poll", "1ms"},
+			finalState: jobFailed, wantCode: exitFailure, wantOut: "job j1 failed", wantErr: []string{"solver diverged"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(&simServer{finalState: tt.finalState})
+			defer srv.Close()
+			code, stdout, stderr := runCLI(t, srv.URL, tt.stdin, append([]string{"simulate"}, tt.args...)...)
+			if code != tt.wantCode {
+				t.Errorf("exit %d, want %d; stderr: %s", code, tt.wantCode, stderr)
+			}
+			if !strings.Contains(stdout, tt.wantOut) {
+				t.Errorf("stdout %q, want it to contain %q", stdout, tt.wantOut)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(stderr, want) {
+					t.Errorf("stderr %q, want it to contain %q", stderr, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateSendsParamsVerbatim(t *testing.T) {
+	ss := &simServer{}
+	srv := httptest.NewServer(ss)
+	defer srv.Close()
+	params := `{"dt": 0.1, "steps": 10}`
+	if code, _, stderr := runCLI(t, srv.URL, params, "simulate", "heat", "--params", "-", "--json"); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if len(ss.bodies) != 1 || ss.bodies[0] != params {
+		t.Errorf("server received %q, want %q", ss.bodies, params)
+	}
+}
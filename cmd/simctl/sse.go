@@ -0,0 +1,67 @@
+// sse.go
+// Minimal reader for text/event-stream responses.
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent is one dispatched server-sent event.
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// sseReader splits an event stream into events. Comment lines such as
+// heartbeats are skipped, and multi-line data fields are joined with "\n".
+type sseReader struct {
+	sc *bufio.Scanner
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	return &sseReader{sc: sc}
+}
+
+// next returns the next event, or io.EOF once the stream ends cleanly.
+func (r *sseReader) next() (*sseEvent, error) {
+	var (
+		ev   sseEvent
+		data []string
+		seen bool
+	)
+	for r.sc.Scan() {
+		line := r.sc.Text()
+		if line == "" {
+			if seen {
+				ev.Data = strings.Join(data, "\n")
+				return &ev, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			ev.Event = value
+		case "id":
+			ev.ID = value
+		default:
+			continue
+		}
+		seen = true
+	}
+	if err := r.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,680 @@
+// sweep.go
+// simctl sweep heat|nbody: run the cross product of parameter variations,
+// collect each result's summary stats and write them to a CSV.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var sweepCmd = &command{
+	name:     "sweep",
+	summary:  "run a parameter sweep and collect the results",
+	children: simTypeCommands("sweep %s parameters", runSweep),
+	examples: []example{
+		{"3 x 2 runs, 4 at a time, into sweep.csv", "simctl sweep heat --base params.json --vary diffusivity=0.1,0.2,0.5 --vary grid=128,256"},
+		{"resume after Ctrl-C: rerun the same command", "simctl sweep heat --base params.json --vary diffusivity=0.1,0.2,0.5 --vary grid=128,256"},
+		{"let the server run the sweep", "simctl sweep heat --base params.json --vary dt=0.01,0.02 --server-side --out -"},
+	},
+}
+
+// vary is one --vary key=v1,v2,... flag. Key may be a dotted path into
+// nested parameters.
+type vary struct {
+	Key    string
+	Values []string
+}
+
+// varyFlag collects repeated --vary flags in order.
+type varyFlag []vary
+
+func (f *varyFlag) String() string { return "" }
+
+func (f *varyFlag) Set(s string) error {
+	key, list, ok := strings.Cut(s, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || list == "" {
+		return fmt.Errorf("want key=v1,v2,..., got %q", s)
+	}
+	for _, v := range *f {
+		if v.Key == key {
+			return fmt.Errorf("%s is varied twice", key)
+		}
+	}
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("no values for %s", key)
+	}
+	*f = append(*f, vary{Key: key, Values: values})
+	return nil
+}
+
+// sweepRun is one parameter combination and what became of it. The same
+// shape is used in the state file and in server-side sweep status.
+type sweepRun struct {
+	Params   json.RawMessage `json:"params"`
+	JobID    string          `json:"job_id,omitempty"`
+	State    string          `json:"state,omitempty"`
+	Filename string          `json:"filename,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Stats    map[string]any  `json:"stats,omitempty"`
+}
+
+// sweepState is the resumable record of a sweep, saved after every change.
+type sweepState struct {
+	Type    string      `json:"type"`
+	SweepID string      `json:"sweep_id,omitempty"` // set for --server-side sweeps
+	Runs    []*sweepRun `json:"runs,omitempty"`
+}
+
+func runSweep(ctx context.Context, e *env, simType string, args []string) error {
+	var varies varyFlag
+	fs := e.flagSet("simctl sweep " + simType + " --base FILE --vary key=v1,v2 [--vary ...] [--out FILE]")
+	basePath := fs.String("base", "", "JSON base parameter file, or - for stdin (required)")
+	fs.Var(&varies, "vary", "parameter in --base and comma-separated values to sweep; repeat for a cross product")
+	out := fs.String("out", "sweep.csv", "CSV file for the results, or - for stdout")
+	statePath := fs.String("state", "", "resumable state file (default OUT.state.json)")
+	concurrency := fs.Int("concurrency", 4, "simulations in flight at once")
+	poll := fs.Duration("poll", defaultPollInterval, "job polling interval")
+	serverSide := fs.Bool("server-side", false, "run the sweep on the server instead of submitting each run")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(rest) > 0:
+		return usagef("unexpected arguments: %q", rest)
+	case *basePath == "":
+		return usagef("--base is required")
+	case len(varies) == 0:
+		return usagef("at least one --vary is required")
+	case *concurrency <= 0:
+		return usagef("--concurrency must be positive")
+	case *poll <= 0:
+		return usagef("--poll must be positive")
+	}
+	if *statePath == "" {
+		*statePath = *out + ".state.json"
+		if *out == "-" {
+			*statePath = "sweep.state.json"
+		}
+	}
+
+	b, err := readJSONInput(e, *basePath, "base parameters")
+	if err != nil {
+		return err
+	}
+	base, err := decodeObject(b)
+	if err != nil {
+		return usagef("base parameters: %v", err)
+	}
+	runs, err := expandSweep(base, varies)
+	if err != nil {
+		return err
+	}
+	st, err := loadSweepState(*statePath, simType, runs)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	sw := &sweeper{e: e, c: c, simType: simType, varies: varies, poll: *poll, statePath: *statePath, state: st, total: len(st.Runs)}
+	if *serverSide {
+		err = sw.runOnServer(ctx, base, varies)
+	} else {
+		err = sw.runLocally(ctx, *concurrency)
+	}
+	if err != nil {
+		return err
+	}
+	return sw.finish(*out)
+}
+
+// expandSweep builds the cross product of varies over base. The last
+// --vary changes fastest, so runs come out in a predictable order.
+func expandSweep(base map[string]any, varies []vary) ([]*sweepRun, error) {
+	combos := [][]any{nil}
+	for _, v := range varies {
+		var next [][]any
+		for _, prefix := range combos {
+			for _, s := range v.Values {
+				next = append(next, append(append([]any(nil), prefix...), varyValue(s)))
+			}
+		}
+		combos = next
+	}
+	runs := make([]*sweepRun, 0, len(combos))
+	for _, combo := range combos {
+		p := deepCopy(base).(map[string]any)
+		for i, v := range varies {
+			if err := setPath(p, v.Key, combo[i]); err != nil {
+				return nil, usagef("--vary %s: %v", v.Key, err)
+			}
+		}
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, &sweepRun{Params: b})
+	}
+	return runs, nil
+}
+
+// varyValue reads a --vary value as a JSON number, boolean or null when it
+// is one, and as a string otherwise.
+func varyValue(s string) any {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		switch v.(type) {
+		case json.Number, bool, nil, string:
+			return v
+		}
+	}
+	return s
+}
+
+func decodeObject(b []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil || m == nil {
+		return nil, errors.New("must be a JSON object")
+	}
+	return m, nil
+}
+
+func deepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, x := range v {
+			m[k] = deepCopy(x)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, x := range v {
+			s[i] = deepCopy(x)
+		}
+		return s
+	}
+	return v
+}
+
+// setPath replaces the value at the dotted path key in m. The key must
+// already be there: a misspelt --vary would otherwise add a parameter the
+// server ignores and run the same simulation once per value.
+func setPath(m map[string]any, key string, v any) error {
+	parts := strings.Split(key, ".")
+	for i, p := range parts[:len(parts)-1] {
+		next, ok := m[p]
+		if !ok {
+			return fmt.Errorf("the base parameters have no %s", strings.Join(parts[:i+1], "."))
+		}
+		if m, ok = next.(map[string]any); !ok {
+			return fmt.Errorf("%s is not an object", p)
+		}
+	}
+	last := parts[len(parts)-1]
+	if _, ok := m[last]; !ok {
+		return fmt.Errorf("the base parameters have no %s", key)
+	}
+	m[last] = v
+	return nil
+}
+
+// getPath looks up the dotted path key in the JSON object params.
+func getPath(params json.RawMessage, key string) any {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.UseNumber()
+	if dec.Decode(&v) != nil {
+		return nil
+	}
+	for _, p := range strings.Split(key, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+// loadSweepState resumes the state at path when it describes the same
+// sweep, or starts a new one with runs when there is no state file.
+func loadSweepState(path, simType string, runs []*sweepRun) (*sweepState, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &sweepState{Type: simType, Runs: runs}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading sweep state: %w", err)
+	}
+	var st sweepState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("sweep state %s: %w", path, err)
+	}
+	if st.Type != simType || !sameRuns(st.Runs, runs) {
+		return nil, usagef("%s belongs to a different sweep; delete it or pass --state", path)
+	}
+	return &st, nil
+}
+
+// sameRuns reports whether a and b hold the same parameter combinations,
+// in any order: a server-side sweep may list its runs differently.
+func sameRuns(a, b []*sweepRun) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	canon := func(runs []*sweepRun) []string {
+		out := make([]string, len(runs))
+		for i, r := range runs {
+			var v any
+			json.Unmarshal(r.Params, &v)
+			c, _ := json.Marshal(v)
+			out[i] = string(c)
+		}
+		sort.Strings(out)
+		return out
+	}
+	ca, cb := canon(a), canon(b)
+	for i := range ca {
+		if ca[i] != cb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sweeper runs a sweep and keeps its state file current.
+type sweeper struct {
+	e         *env
+	c         *client
+	simType   string
+	varies    []vary
+	poll      time.Duration
+	statePath string
+
+	mu    sync.Mutex // guards state, done and retry
+	state *sweepState
+	done  int
+	retry int // runs left pending by transient errors
+	total int
+}
+
+// update applies f to the state under the lock and saves it. Save errors
+// are reported but do not stop the sweep.
+func (s *sweeper) update(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f()
+	if err := s.save(); err != nil {
+		fmt.Fprintf(s.e.stderr, "simctl: warning: saving sweep state: %v\n", err)
+	}
+}
+
+func (s *sweeper) save() error {
+	b, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.statePath + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.statePath)
+}
+
+// pending reports whether r still needs work: not finished, or succeeded
+// without its stats.
+func (r *sweepRun) pending() bool {
+	j := job{State: r.State}
+	return !j.terminal() || (r.State == jobSucceeded && r.Stats == nil)
+}
+
+// runLocally submits every pending run, at most concurrency at a time.
+func (s *sweeper) runLocally(ctx context.Context, concurrency int) error {
+	var todo []*sweepRun
+	for _, r := range s.state.Runs {
+		if r.pending() {
+			todo = append(todo, r)
+		} else {
+			s.done++
+		}
+	}
+	if s.done > 0 {
+		fmt.Fprintf(s.e.stderr, "resuming sweep: %d of %d runs already finished\n", s.done, s.total)
+	}
+	s.update(func() {})
+
+	work := make(chan *sweepRun)
+	var wg sync.WaitGroup
+	for range min(concurrency, max(len(todo), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				s.runOne(ctx, r)
+			}
+		}()
+	}
+feed:
+	for _, r := range todo {
+		select {
+		case work <- r:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return &interruptedError{msg: fmt.Sprintf("sweep interrupted after %d of %d runs; rerun the same command to resume (state in %s)",
+			s.done, s.total, s.statePath)}
+	}
+	if s.retry > 0 {
+		return fmt.Errorf("%d of %d sweep runs hit transient errors and are still pending; rerun the same command to retry them (state in %s)",
+			s.retry, s.total, s.statePath)
+	}
+	return nil
+}
+
+// runOne takes r from wherever it stopped: submission, waiting or stats.
+// Only the job's own outcome, or the server rejecting the run, finishes
+// it; after a transient error it stays pending for the next attempt.
+func (s *sweeper) runOne(ctx context.Context, r *sweepRun) {
+	if r.JobID == "" {
+		sub, err := submitJob(ctx, s.c, "/api/simulate/"+s.simType, r.Params)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil && transient(err):
+			s.retryLater(r, err.Error())
+			return
+		case err != nil:
+			s.finishRun(r, "", jobFailed, err.Error())
+			return
+		}
+		s.update(func() { r.JobID, r.State = sub.JobID, jobQueued })
+	}
+	if r.State != jobSucceeded {
+		j, err := followJob(ctx, s.c, r.JobID, s.poll, func(*job) {})
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil && transient(err):
+			s.retryLater(r, err.Error())
+			return
+		case err != nil:
+			s.finishRun(r, "", jobFailed, err.Error())
+			return
+		}
+		if j.State != jobSucceeded {
+			s.finishRun(r, "", j.State, j.Error)
+			return
+		}
+		s.update(func() { r.State, r.Filename = jobSucceeded, j.Filename })
+	}
+	var stats map[string]any
+	if err := s.c.getJSON(ctx, resultPath(r.Filename)+"/stats", nil, &stats); err != nil {
+		switch {
+		case ctx.Err() != nil:
+		case transient(err):
+			s.retryLater(r, "fetching stats: "+err.Error())
+		default:
+			s.finishRun(r, r.Filename, jobSucceeded, "fetching stats: "+err.Error())
+		}
+		return
+	}
+	s.update(func() { r.Stats = stats })
+	s.finishRun(r, r.Filename, jobSucceeded, "")
+}
+
+func (s *sweeper) finishRun(r *sweepRun, filename, state, msg string) {
+	s.update(func() {
+		r.Filename, r.State, r.Error = filename, state, msg
+		s.done++
+		fmt.Fprintf(s.e.stderr, "[%d/%d] %s %s\n", s.done, s.total, s.label(r), state)
+	})
+}
+
+// retryLater leaves r pending after a transient error. Its job ID, if it
+// has one, is kept so the next attempt follows that job rather than
+// submitting the run again.
+func (s *sweeper) retryLater(r *sweepRun, msg string) {
+	s.update(func() {
+		r.Error = msg
+		s.retry++
+		fmt.Fprintf(s.e.stderr, "[%d/%d] %s still pending: %s\n", s.done, s.total, s.label(r), msg)
+	})
+}
+
+// transient reports whether err may go away on a later attempt: the server
+// was unreachable, timed out, was overloaded or failed internally.
+func transient(err error) bool {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.Status >= 500 || ae.Status == http.StatusRequestTimeout || ae.Status == http.StatusTooManyRequests
+	}
+	var te *transportError
+	return errors.As(err, &te)
+}
+
+// label names a run by its varied values, e.g. "diffusivity=0.1 grid=128".
+func (s *sweeper) label(r *sweepRun) string {
+	parts := make([]string, len(s.varies))
+	for i, v := range s.varies {
+		parts[i] = v.Key + "=" + metricString(getPath(r.Params, v.Key))
+	}
+	return strings.Join(parts, " ")
+}
+
+// sweepStatus is GET /api/sweeps/:id.
+type sweepStatus struct {
+	ID       string      `json:"id"`
+	State    string      `json:"state"`
+	Progress *float64    `json:"progress,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Runs     []*sweepRun `json:"runs"`
+}
+
+// runOnServer submits the whole sweep to /api/sweeps, or follows the one
+// recorded in the state file, and takes the runs from its final status.
+func (s *sweeper) runOnServer(ctx context.Context, base map[string]any, varies []vary) error {
+	if s.state.SweepID == "" {
+		spec := map[string]any{"type": s.simType, "base": base}
+		vs := map[string][]any{}
+		for _, v := range varies {
+			for _, x := range v.Values {
+				vs[v.Key] = append(vs[v.Key], varyValue(x))
+			}
+		}
+		spec["vary"] = vs
+		var sub struct {
+			SweepID string `json:"sweep_id"`
+			ID      string `json:"id"`
+		}
+		if err := s.c.postJSON(ctx, "/api/sweeps", nil, spec, &sub); err != nil {
+			var ae *apiError
+			if errors.As(err, &ae) && (ae.Status == 404 || ae.Status == 405 || ae.Status == 501) {
+				return fmt.Errorf("server does not support server-side sweeps; run without --server-side: %w", err)
+			}
+			return err
+		}
+		id := sub.SweepID
+		if id == "" {
+			id = sub.ID
+		}
+		if id == "" {
+			return fmt.Errorf("server accepted the sweep but returned no sweep_id")
+		}
+		s.update(func() { s.state.SweepID = id })
+		fmt.Fprintf(s.e.stderr, "sweep %s submitted (%d runs)\n", id, s.total)
+	}
+
+	sp := newSpinner(s.e.stderr)
+	defer sp.done()
+	t := time.NewTicker(s.poll)
+	defer t.Stop()
+	for {
+		var st sweepStatus
+		err := s.c.getJSON(ctx, "/api/sweeps/"+url.PathEscape(s.state.SweepID), nil, &st)
+		if ctx.Err() != nil {
+			return &interruptedError{msg: fmt.Sprintf("interrupted; sweep %s is still running on the server; rerun the same command to collect it", s.state.SweepID)}
+		}
+		if err != nil {
+			return err
+		}
+		j := job{ID: st.ID, State: st.State, Progress: st.Progress, Error: st.Error}
+		sp.update("sweep " + s.state.SweepID + " " + j.String())
+		if j.terminal() {
+			if st.State != jobSucceeded && len(st.Runs) == 0 {
+				return j.err()
+			}
+			s.update(func() { s.state.Runs = st.Runs })
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+	}
+}
+
+// sweepSummary is the command's structured result.
+type sweepSummary struct {
+	CSV       string `json:"csv"`
+	State     string `json:"state_file"`
+	Runs      int    `json:"runs"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+}
+
+// finish writes the CSV and reports the outcome; any failed run makes the
+// command fail.
+func (s *sweeper) finish(out string) error {
+	sum := sweepSummary{CSV: out, State: s.statePath, Runs: len(s.state.Runs)}
+	for _, r := range s.state.Runs {
+		if r.State == jobSucceeded && r.Error == "" {
+			sum.Succeeded++
+		} else {
+			sum.Failed++
+		}
+	}
+	if out == "-" {
+		if err := writeSweepCSV(s.e.stdout, s.varies, s.state.Runs); err != nil {
+			return err
+		}
+	} else {
+		if err := writeSweepFile(out, s.varies, s.state.Runs); err != nil {
+			return err
+		}
+		err := s.e.emit(sum, func(w io.Writer) {
+			fmt.Fprintf(w, "wrote %s: %d runs, %d succeeded, %d failed\n", out, sum.Runs, sum.Succeeded, sum.Failed)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if sum.Failed > 0 {
+		return fmt.Errorf("%d of %d sweep runs failed; see the error column in %s", sum.Failed, sum.Runs, displayPath(out))
+	}
+	return nil
+}
+
+func writeSweepFile(path string, varies []vary, runs []*sweepRun) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sweep-*.csv")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeSweepCSV(tmp, varies, runs); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeSweepCSV writes one row per run: the varied parameters, then the
+// run's state and result, then every stat reported by any run.
+func writeSweepCSV(w io.Writer, varies []vary, runs []*sweepRun) error {
+	metricSet := map[string]bool{}
+	for _, r := range runs {
+		for k := range r.Stats {
+			metricSet[k] = true
+		}
+	}
+	metrics := make([]string, 0, len(metricSet))
+	for k := range metricSet {
+		metrics = append(metrics, k)
+	}
+	sort.Strings(metrics)
+
+	cw := csv.NewWriter(w)
+	header := []string{}
+	for _, v := range varies {
+		header = append(header, v.Key)
+	}
+	header = append(header, "state", "filename")
+	header = append(header, metrics...)
+	cw.Write(append(header, "error"))
+	for _, r := range runs {
+		var rec []string
+		for _, v := range varies {
+			rec = append(rec, metricString(getPath(r.Params, v.Key)))
+		}
+		rec = append(rec, r.State, r.Filename)
+		for _, m := range metrics {
+			rec = append(rec, metricString(r.Stats[m]))
+		}
+		cw.Write(append(rec, r.Error))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func metricString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case json.Number:
+		return v.String()
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
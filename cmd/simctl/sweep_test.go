@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sweepServer fakes per-run submission, jobs that run for one poll, and
+// result stats. Runs with dt=0 fail. failSubmits and failPolls make that
+// many submissions or job polls answer with a 5xx first.
+type sweepServer struct {
+	mu          sync.Mutex
+	submitted   []string
+	jobs        map[string]*sweepJob
+	active      int
+	maxActive   int
+	failSubmits int
+	failPolls   int
+}
+
+type sweepJob struct {
+	params map[string]any
+	polls  int
+}
+
+func newSweepServer() *sweepServer { return &sweepServer{jobs: map[string]*sweepJob{}} }
+
+func (s *sweepServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.URL.Path == "/api/simulate/heat" && r.URL.Query().Get("async") == "true":
+		if s.failSubmits > 0 {
+			s.failSubmits--
+			writeJSONResponse(w, http.StatusServiceUnavailable, map[string]any{"error": "restarting"})
+			return
+		}
+		var p map[string]any
+		json.NewDecoder(r.Body).Decode(&p)
+		b, _ := json.Marshal(p)
+		s.submitted = append(s.submitted, string(b))
+		id := fmt.Sprintf("j%d", len(s.submitted))
+		s.jobs[id] = &sweepJob{params: p}
+		s.active++
+		s.maxActive = max(s.maxActive, s.active)
+		writeJSONResponse(w, http.StatusAccepted, map[string]string{"job_id": id})
+	case strings.HasPrefix(r.URL.Path, "/api/jobs/"):
+		id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+		j, ok := s.jobs[id]
+		if !ok {
+			writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "no such job"})
+			return
+		}
+		if s.failPolls > 0 {
+			s.failPolls--
+			writeJSONResponse(w, http.StatusBadGateway, map[string]any{"error": "bad gateway"})
+			return
+		}
+		j.polls++
+		switch {
+		case j.polls == 1:
+			writeJSONResponse(w, http.StatusOK, job{ID: id, State: jobRunning})
+			return
+		case j.polls == 2:
+			s.active--
+		}
+		if j.params["dt"] == 0.0 {
+			writeJSONResponse(w, http.StatusOK, job{ID: id, State: jobFailed, Error: "dt must be positive"})
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, job{ID: id, State: jobSucceeded, Filename: "heat_" + id + ".json"})
+	case strings.HasSuffix(r.URL.Path, "/stats"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/results/"), "/stats")
+		j := s.jobs[strings.TrimSuffix(strings.TrimPrefix(name, "heat_"), ".json")]
+		grid, _ := j.params["grid"].(float64)
+		if mesh, ok := j.params["mesh"].(map[string]any); ok {
+			grid, _ = mesh["grid"].(float64)
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]any{"max_temp": j.params["dt"].(float64) * grid, "steps": 10})
+	default:
+		writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "not found"})
+	}
+}
+
+func sweepArgs(dir string, extra ...string) []string {
+	base := filepath.Join(dir, "base.json")
+	os.WriteFile(base, []byte(`{"dt": 0.1, "steps": 10, "mesh": {"grid": 64}}`), 0o644)
+	args := []string{"sweep", "heat", "--base", base, "--out", filepath.Join(dir, "sweep.csv"), "--poll", "5ms"}
+	return append(args, extra...)
+}
+
+func TestExpandSweep(t *testing.T) {
+	base := map[string]any{"dt": json.Number("0.1"), "mesh": map[string]any{"grid": json.Number("64")}}
+	runs, err := expandSweep(base, []vary{
+		{Key: "dt", Values: []string{"0.1", "0.2"}},
+		{Key: "mesh.grid", Values: []string{"128", "256"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"dt":0.1,"mesh":{"grid":128}}`,
+		`{"dt":0.1,"mesh":{"grid":256}}`,
+		`{"dt":0.2,"mesh":{"grid":128}}`,
+		`{"dt":0.2,"mesh":{"grid":256}}`,
+	}
+	if len(runs) != len(want) {
+		t.Fatalf("%d runs, want %d", len(runs), len(want))
+	}
+	for i, r := range runs {
+		if string(r.Params) != want[i] {
+			t.Errorf("run %d: %s, want %s", i, r.Params, want[i])
+		}
+	}
+	if base["mesh"].(map[string]any)["grid"] != json.Number("64") {
+		t.Error("expandSweep modified the base parameters")
+	}
+	for _, key := range []string{"dt.x", "dtt", "mesh.gird", "solver.tol"} {
+		if _, err := expandSweep(base, []vary{{Key: key, Values: []string{"1"}}}); exitCode(err) != exitUsage {
+			t.Errorf("--vary %s: %v", key, err)
+		}
+	}
+}
+
+func TestVaryFlag(t *testing.T) {
+	var f varyFlag
+	for _, bad := range []string{"dt", "=1", "dt=", "dt=,"} {
+		if err := f.Set(bad); err == nil {
+			t.Errorf("Set(%q) accepted", bad)
+		}
+	}
+	if err := f.Set("dt=1, 2"); err != nil || len(f) != 1 || len(f[0].Values) != 2 || f[0].Values[1] != "2" {
+		t.Errorf("Set: %v %+v", err, f)
+	}
+	if err := f.Set("dt=3"); err == nil {
+		t.Error("duplicate key accepted")
+	}
+}
+
+func TestSweepLocal(t *testing.T) {
+	srv := newSweepServer()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+
+	code, stdout, stderr := runCLI(t, ts.URL, "", sweepArgs(dir, "--vary", "dt=0.1,0.2,0.5", "--vary", "mesh.grid=10,20", "--concurrency", "2")...)
+	if code != exitOK {
+		t.Fatalf("exit %d; stderr: %s", code, stderr)
+	}
+	if len(srv.submitted) != 6 || srv.maxActive > 2 {
+		t.Errorf("%d submissions, %d in flight at most; want 6 and at most 2", len(srv.submitted), srv.maxActive)
+	}
+	if !strings.Contains(stdout, "6 runs, 6 succeeded, 0 failed") || !strings.Contains(stderr, "[6/6]") {
+		t.Errorf("stdout %q, stderr %q", stdout, stderr)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "sweep.csv"))
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if lines[0] != "dt,mesh.grid,state,filename,max_temp,steps,error" || len(lines) != 7 {
+		t.Fatalf("csv:\n%s", b)
+	}
+	rows := map[string]bool{}
+	for _, l := range lines[1:] {
+		f := strings.Split(l, ",")
+		rows[f[0]+","+f[1]+","+f[2]+","+f[4]] = true
+	}
+	for _, want := range []string{"0.1,10,succeeded,1", "0.2,20,succeeded,4", "0.5,20,succeeded,10"} {
+		if !rows[want] {
+			t.Errorf("csv has no row %s:\n%s", want, b)
+		}
+	}
+}
+
+func TestSweepRejectsUnknownVaryKey(t *testing.T) {
+	srv := newSweepServer()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	code, _, stderr := runCLI(t, ts.URL, "", sweepArgs(t.TempDir(), "--vary", "dtt=0.1,0.2")...)
+	if code != exitUsage || !strings.Contains(stderr, "--vary dtt: the base parameters have no dtt") {
+		t.Errorf("exit %d, stderr %q", code, stderr)
+	}
+	if len(srv.submitted) != 0 {
+		t.Errorf("submitted %q", srv.submitted)
+	}
+}
+
+func TestSweepFailedRun(t *testing.T) {
+	ts := httptest.NewServer(newSweepServer())
+	defer ts.Close()
+	dir := t.TempDir()
+	code, _, stderr := runCLI(t, ts.URL, "", sweepArgs(dir, "--vary", "dt=0,0.1")...)
+	if code != exitFailure || !strings.Contains(stderr, "1 of 2 sweep runs failed") {
+		t.Errorf("exit %d, stderr %q", code, stderr)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "sweep.csv"))
+	if !strings.Contains(string(b), "0,failed,,,,dt must be positive") {
+		t.Errorf("csv:\n%s", b)
+	}
+}
+
+func TestSweepResume(t *testing.T) {
+	srv := newSweepServer()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+	args := sweepArgs(dir, "--vary", "dt=0.1,0.2,0.5")
+
+	// A previous run finished dt=0.1, submitted dt=0.2 as job j1 and was
+	// interrupted before submitting dt=0.5.
+	srv.jobs["j1"] = &sweepJob{params: map[string]any{"dt": 0.2, "grid": 1.0}}
+	srv.submitted = []string{`{"dt":0.2}`}
+	state := sweepState{Type: "heat", Runs: []*sweepRun{
+		{Params: json.RawMessage(`{"dt":0.1,"mesh":{"grid":64},"steps":10}`), JobID: "old", State: jobSucceeded,
+			Filename: "heat_old.json", Stats: map[string]any{"max_temp": 7}},
+		{Params: json.RawMessage(`{"dt":0.2,"mesh":{"grid":64},"steps":10}`), JobID: "j1", State: jobQueued},
+		{Params: json.RawMessage(`{"dt":0.5,"mesh":{"grid":64},"steps":10}`)},
+	}}
+	b, _ := json.Marshal(state)
+	statePath := filepath.Join(dir, "sweep.csv.state.json")
+	os.WriteFile(statePath, b, 0o644)
+
+	code, _, stderr := runCLI(t, ts.URL, "", args...)
+	if code != exitOK {
+		t.Fatalf("exit %d; stderr: %s", code, stderr)
+	}
+	if len(srv.submitted) != 2 || !strings.Contains(srv.submitted[1], `"dt":0.5`) {
+		t.Errorf("submissions %q; want only dt=0.5 resubmitted", srv.submitted)
+	}
+	if !strings.Contains(stderr, "1 of 3 runs already finished") {
+		t.Errorf("stderr %q", stderr)
+	}
+	csvOut, _ := os.ReadFile(filepath.Join(dir, "sweep.csv"))
+	if !strings.Contains(string(csvOut), "0.1,succeeded,heat_old.json,7,") {
+		t.Errorf("csv lost the earlier run:\n%s", csvOut)
+	}
+
+	// The state file now describes a different sweep.
+	code, _, stderr = runCLI(t, ts.URL, "", sweepArgs(dir, "--vary", "dt=1,2")...)
+	if code != exitUsage || !strings.Contains(stderr, "belongs to a different sweep") {
+		t.Errorf("mismatched state: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestSweepTransientErrors(t *testing.T) {
+	srv := newSweepServer()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+	args := sweepArgs(dir, "--vary", "dt=0.1,0.2", "--concurrency", "1")
+
+	// The server is restarting when dt=0.1 is submitted, and the first
+	// poll of dt=0.2's job j1 gets a 502. Neither run is failed.
+	srv.failSubmits, srv.failPolls = 1, 1
+	code, _, stderr := runCLI(t, ts.URL, "", args...)
+	if code != exitFailure || !strings.Contains(stderr, "2 of 2 sweep runs hit transient errors") {
+		t.Fatalf("first attempt: exit %d, stderr %q", code, stderr)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "sweep.csv.state.json"))
+	var st sweepState
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Runs) != 2 || !st.Runs[0].pending() || st.Runs[0].JobID != "" || !st.Runs[1].pending() || st.Runs[1].JobID != "j1" {
+		t.Fatalf("state after transient errors:\n%s", b)
+	}
+
+	// The rerun submits dt=0.1 and follows j1 instead of resubmitting it.
+	code, stdout, stderr := runCLI(t, ts.URL, "", args...)
+	if code != exitOK || !strings.Contains(stdout, "2 runs, 2 succeeded, 0 failed") {
+		t.Fatalf("rerun: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if len(srv.submitted) != 2 || !strings.Contains(srv.submitted[1], `"dt":0.1`) {
+		t.Errorf("submissions %q; want dt=0.2 once and dt=0.1 on the rerun", srv.submitted)
+	}
+}
+
+func TestSweepServerSide(t *testing.T) {
+	var mu sync.Mutex
+	var spec map[string]any
+	posts, polls := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/sweeps":
+			posts++
+			json.NewDecoder(r.Body).Decode(&spec)
+			writeJSONResponse(w, http.StatusAccepted, map[string]string{"sweep_id": "s1"})
+		case r.URL.Path == "/api/sweeps/s1":
+			polls++
+			if polls < 2 {
+				writeJSONResponse(w, http.StatusOK, map[string]any{"id": "s1", "state": "running", "progress": 50})
+				return
+			}
+			writeJSONResponse(w, http.StatusOK, map[string]any{"id": "s1", "state": "succeeded", "runs": []map[string]any{
+				{"params": map[string]any{"dt": 0.2, "steps": 10, "mesh": map[string]any{"grid": 64}}, "state": "succeeded", "filename": "b.json", "stats": map[string]any{"max_temp": 2}},
+				{"params": map[string]any{"dt": 0.1, "steps": 10, "mesh": map[string]any{"grid": 64}}, "state": "succeeded", "filename": "a.json", "stats": map[string]any{"max_temp": 1}},
+			}})
+		default:
+			writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "not found"})
+		}
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	args := sweepArgs(dir, "--vary", "dt=0.1,0.2", "--server-side", "--out", "-", "--state", filepath.Join(dir, "state.json"))
+
+	code, _, stderr := runCLI(t, ts.URL, "", args...)
+	if code != exitOK {
+		t.Fatalf("exit %d; stderr: %s", code, stderr)
+	}
+	if vs, _ := spec["vary"].(map[string]any); spec["type"] != "heat" || fmt.Sprint(vs["dt"]) != "[0.1 0.2]" {
+		t.Errorf("sweep spec %v", spec)
+	}
+
+	// Rerunning collects the same sweep again rather than submitting a new one.
+	code, stdout, stderr := runCLI(t, ts.URL, "", args...)
+	if posts != 1 {
+		t.Errorf("sweep submitted %d times, want once", posts)
+	}
+	if code != exitOK || !strings.Contains(stdout, "dt,state,filename,max_temp,error\n0.2,succeeded,b.json,2,\n0.1,succeeded,a.json,1,\n") {
+		t.Errorf("exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	dir = t.TempDir()
+	code, _, stderr = runCLI(t, missing.URL, "", sweepArgs(dir, "--vary", "dt=1", "--server-side", "--state", filepath.Join(dir, "state.json"))...)
+	if code != exitNotFound || !strings.Contains(stderr, "does not support server-side sweeps") {
+		t.Errorf("no sweep endpoint: exit %d, stderr %q", code, stderr)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+// tty_bsd.go
+package main
+
+import "syscall"
+
+const ioctlGetTermios = syscall.TIOCGETA
@@ -0,0 +1,6 @@
+// tty_linux.go
+package main
+
+import "syscall"
+
+const ioctlGetTermios = syscall.TCGETS
@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+// tty_other.go
+// Terminal detection where no termios ioctl is available.
+package main
+
+import "os"
+
+// isTerminal reports whether v is an *os.File on a character device other
+// than the null device.
+func isTerminal(v any) bool {
+	f, ok := v.(*os.File)
+	if !ok || f == nil {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+// terminalWidth is unknown here; tables fit $COLUMNS when it is set.
+func terminalWidth(v any) int { return 0 }
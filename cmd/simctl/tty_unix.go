@@ -0,0 +1,38 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+// tty_unix.go
+// Terminal detection and size via the termios ioctls.
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal reports whether v is an *os.File attached to a tty. Unlike a
+// ModeCharDevice check it is false for /dev/null and other devices.
+func isTerminal(v any) bool {
+	f, ok := v.(*os.File)
+	if !ok || f == nil {
+		return false
+	}
+	var t syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlGetTermios, uintptr(unsafe.Pointer(&t)))
+	return errno == 0
+}
+
+// terminalWidth returns the column count of the terminal on v, or 0 when
+// it cannot be determined.
+func terminalWidth(v any) int {
+	f, ok := v.(*os.File)
+	if !ok || f == nil {
+		return 0
+	}
+	var ws struct{ Row, Col, X, Y uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.Col)
+}
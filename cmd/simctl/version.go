@@ -0,0 +1,83 @@
+// version.go
+// simctl version: client build info plus the server's, when reachable.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Build info, injected at build time:
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+var versionCmd = &command{
+	name:    "version",
+	summary: "print client and server version",
+	run:     runVersion,
+	examples: []example{
+		{"client and server versions", "simctl version"},
+		{"client only, without contacting the server", "simctl version --client"},
+	},
+}
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+}
+
+type versionOutput struct {
+	Client buildInfo  `json:"client"`
+	Server *buildInfo `json:"server,omitempty"`
+}
+
+func runVersion(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl version [--client]")
+	clientOnly := fs.Bool("client", false, "do not contact the server")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	out := versionOutput{Client: buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}}
+	// The client half is printed even when the server cannot be asked, but
+	// the server's error still decides the exit code; --client is the way
+	// to ask offline.
+	var serverErr error
+	if !*clientOnly {
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+		var srv buildInfo
+		if serverErr = c.getJSON(ctx, "/api/version", nil, &srv); serverErr == nil {
+			out.Server = &srv
+		}
+	}
+
+	err := e.emit(out, func(w io.Writer) {
+		fmt.Fprintf(w, "client: %s (commit %s, built %s, %s)\n",
+			out.Client.Version, out.Client.Commit, out.Client.BuildDate, out.Client.GoVersion)
+		if out.Server != nil {
+			fmt.Fprintf(w, "server: %s (commit %s, built %s)\n",
+				out.Server.Version, out.Server.Commit, out.Server.BuildDate)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serverErr
+}
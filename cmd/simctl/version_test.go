@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	found := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusOK, map[string]string{"version": "v0.9.0", "commit": "abc123"})
+	}))
+	defer found.Close()
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	tests := []struct {
+		name     string
+		server   string
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{"server reachable", found.URL, nil, exitOK, "server: v0.9.0 (commit abc123"},
+		{"endpoint missing", missing.URL, nil, exitNotFound, "client: dev"},
+		{"unreachable", "http://127.0.0.1:1", nil, exitTransport, "client: dev"},
+		{"client only", "http://127.0.0.1:1", []string{"--client"}, exitOK, "client: dev"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, tt.server, "", append([]string{"version"}, tt.args...)...)
+		if code != tt.wantCode || !strings.Contains(stdout, tt.wantOut) {
+			t.Errorf("%s: exit %d, stdout %q, stderr %q; want exit %d containing %q",
+				tt.name, code, stdout, stderr, tt.wantCode, tt.wantOut)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// watch.go
+// simctl watch job|queue: live job progress and queue monitoring.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var watchCmd = &command{
+	name:    "watch",
+	summary: "follow a job or the queue live",
+	children: []*command{
+		{name: "job", summary: "follow a job until it finishes", run: runWatchJob, examples: []example{
+			{"follow a job; Ctrl-C detaches and leaves it running", "simctl watch job 42"},
+			{"cancel the job on Ctrl-C", "simctl watch job 42 --cancel-on-interrupt"},
+		}},
+		{name: "queue", summary: "show queue depth and worker utilization", run: runWatchQueue, examples: []example{
+			{"refresh every 5 seconds", "simctl watch queue --interval 5s"},
+			{"one JSON snapshot for monitoring", "simctl watch queue --once --json"},
+		}},
+	},
+}
+
+// errNoStream means the server does not stream job events, or the stream
+// ended before the job did; the caller falls back to polling.
+var errNoStream = errors.New("job event stream unavailable")
+
+func runWatchJob(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl watch job ID [--cancel-on-interrupt]")
+	cancelOnInterrupt := fs.Bool("cancel-on-interrupt", false, "cancel the job on Ctrl-C instead of detaching")
+	poll := fs.Duration("poll", defaultPollInterval, "polling interval when the server does not stream events")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usagef("watch job takes exactly one job ID")
+	}
+	if *poll <= 0 {
+		return usagef("--poll must be positive")
+	}
+	id := rest[0]
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	r := newJobRenderer(e)
+	j, err := streamJob(ctx, c, id, r.update)
+	if errors.Is(err, errNoStream) && ctx.Err() == nil {
+		j, err = followJob(ctx, c, id, *poll, r.update)
+	}
+	r.finish()
+
+	if ctx.Err() != nil {
+		if !*cancelOnInterrupt {
+			return detached(id)
+		}
+		if err := cancelJob(c, id); err != nil {
+			return fmt.Errorf("interrupted, but cancelling job %s failed: %w", id, err)
+		}
+		return &interruptedError{msg: fmt.Sprintf("interrupted; job %s cancelled", id)}
+	}
+	if err != nil {
+		return err
+	}
+	return j.err()
+}
+
+// streamJob follows the job's server-sent events, passing each status to
+// update, until it reaches a terminal state.
+func streamJob(ctx context.Context, c *client, id string, update func(*job)) (*job, error) {
+	req := request{Method: http.MethodGet, Path: "/api/jobs/" + url.PathEscape(id) + "/events", Header: http.Header{}}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.send(ctx, req)
+	var ae *apiError
+	if errors.As(err, &ae) {
+		switch ae.Status {
+		case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusNotImplemented:
+			return nil, errNoStream
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		return nil, errNoStream
+	}
+
+	sr := newSSEReader(resp.Body)
+	for {
+		ev, err := sr.next()
+		if err != nil {
+			// A dropped stream is not fatal: polling picks up from here.
+			return nil, errNoStream
+		}
+		if ev.Data == "" {
+			continue
+		}
+		var j job
+		if err := json.Unmarshal([]byte(ev.Data), &j); err != nil {
+			return nil, fmt.Errorf("decoding %q event for job %s: %w", ev.Event, id, err)
+		}
+		if j.ID == "" {
+			j.ID = id
+		}
+		update(&j)
+		if j.terminal() {
+			return &j, nil
+		}
+	}
+}
+
+// jobRenderer prints job updates to stdout. On a terminal the current
+// state's progress is redrawn in place and each state change starts a new
+// line; elsewhere a line is printed per state change and per 10 points of
+// progress. Other --output formats write every update through a
+// streamWriter.
+type jobRenderer struct {
+	e       *env
+	out     *streamWriter
+	tty     bool
+	state   string
+	width   int
+	printed float64 // progress at the last non-tty line
+}
+
+func newJobRenderer(e *env) *jobRenderer {
+	return &jobRenderer{e: e, out: e.newStream(), tty: e.output == outputTable && isTerminal(e.stdout)}
+}
+
+func (r *jobRenderer) update(j *job) {
+	w := r.e.stdout
+	switch {
+	case r.e.output != outputTable:
+		r.out.write(j, nil)
+	case r.tty:
+		if j.State != r.state && r.width > 0 {
+			fmt.Fprintln(w)
+			r.width = 0
+		}
+		line := "job " + j.ID + " " + j.String()
+		fmt.Fprintf(w, "\r%-*s", r.width, line)
+		r.width = max(r.width, len(line))
+	case j.State != r.state:
+		r.printed = 0
+		if j.Progress != nil {
+			r.printed = *j.Progress
+		}
+		fmt.Fprintf(w, "job %s %s\n", j.ID, j.String())
+	case j.Progress != nil && *j.Progress-r.printed >= 10:
+		r.printed = *j.Progress
+		fmt.Fprintf(w, "job %s %s\n", j.ID, j.String())
+	}
+	if j.terminal() && j.Error != "" && r.e.output == outputTable {
+		r.finish()
+		fmt.Fprintf(w, "  error: %s\n", j.Error)
+	}
+	r.state = j.State
+}
+
+func (r *jobRenderer) finish() {
+	if r.tty && r.width > 0 {
+		fmt.Fprintln(r.e.stdout)
+		r.width = 0
+	}
+}
+
+// queueStats is the queue section of GET /api/stats.
+type queueStats struct {
+	Depth       int `json:"depth"`
+	Running     int `json:"running"`
+	Workers     int `json:"workers"`
+	BusyWorkers int `json:"busy_workers"`
+}
+
+func runWatchQueue(ctx context.Context, e *env, args []string) error {
+	fs := e.flagSet("simctl watch queue [--interval DUR] [--once]")
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval")
+	once := fs.Bool("once", false, "print the current state once and exit")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usagef("unexpected arguments: %q", rest)
+	}
+	if *interval <= 0 {
+		return usagef("--interval must be positive")
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	out := e.newStream()
+	tty := e.output == outputTable && isTerminal(e.stdout)
+	t := time.NewTicker(*interval)
+	defer t.Stop()
+	for {
+		var stats struct {
+			Queue queueStats `json:"queue"`
+		}
+		if err := c.getJSON(ctx, "/api/stats", nil, &stats); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := printQueue(out, stats.Queue, tty); err != nil {
+			return err
+		}
+		if *once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			// Ctrl-C is the normal way to stop watching the queue.
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func printQueue(out *streamWriter, q queueStats, tty bool) error {
+	return out.write(q, func(w io.Writer) { drawQueue(w, q, tty) })
+}
+
+// drawQueue is the table view of one queue snapshot.
+func drawQueue(w io.Writer, q queueStats, tty bool) {
+	util := 0.0
+	if q.Workers > 0 {
+		util = 100 * float64(q.BusyWorkers) / float64(q.Workers)
+	}
+	line := fmt.Sprintf("queued %d  running %d  workers %d/%d busy (%.0f%%)",
+		q.Depth, q.Running, q.BusyWorkers, q.Workers, util)
+	if !tty {
+		fmt.Fprintln(w, time.Now().Format("15:04:05")+"  "+line)
+		return
+	}
+	// Clear the screen and redraw, with a bar for worker utilization.
+	const width = 30
+	// busy_workers can briefly exceed workers while the pool resizes.
+	filled := min(max(int(util/100*width), 0), width)
+	fmt.Fprintf(w, "\x1b[H\x1b[2Jsimctl watch queue — %s\n\n", time.Now().Format("15:04:05"))
+	fmt.Fprintf(w, "  queued   %d\n  running  %d\n  workers  [%s%s] %d/%d\n",
+		q.Depth, q.Running, strings.Repeat("#", filled), strings.Repeat(".", width-filled), q.BusyWorkers, q.Workers)
+	io.WriteString(w, "\n  Ctrl-C to exit\n")
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// sseServer streams events for job j1 and records cancel requests. With
+// hold set, it stops after the events and waits for the client to go away.
+type sseServer struct {
+	events    []string // data payloads
+	noStream  bool     // answer 404 on the events endpoint
+	hold      chan struct{}
+	polled    atomic.Int32
+	cancelled atomic.Int32
+}
+
+func (s *sseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/api/jobs/j1/events":
+		if s.noStream {
+			writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "not found"})
+			return
+		}
+		if r.Header.Get("Accept") != "text/event-stream" {
+			http.Error(w, "want event stream", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fl := w.(http.Flusher)
+		io.WriteString(w, ": connected\n\n")
+		for i, data := range s.events {
+			fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", i, data)
+			fl.Flush()
+		}
+		if s.hold != nil {
+			close(s.hold)
+			<-r.Context().Done()
+		}
+	case r.URL.Path == "/api/jobs/j1":
+		n := s.polled.Add(1)
+		if n < 2 {
+			writeJSONResponse(w, http.StatusOK, map[string]any{"id": "j1", "state": "running", "progress": 40})
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]any{"id": "j1", "state": "succeeded", "filename": "heat_1.csv"})
+	case r.URL.Path == "/api/jobs/j1/cancel" && r.Method == http.MethodPost:
+		s.cancelled.Add(1)
+		writeJSONResponse(w, http.StatusOK, map[string]any{"id": "j1", "state": "cancelled"})
+	default:
+		writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "not found"})
+	}
+}
+
+func TestWatchJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		srv      *sseServer
+		args     []string
+		wantCode int
+		wantOut  []string
+		polls    bool
+	}{
+		{
+			name: "stream success",
+			srv: &sseServer{events: []string{
+				`{"id":"j1","state":"queued"}`,
+				`{"id":"j1","state":"running","progress":10}`,
+				`{"id":"j1","state":"running","progress":15}`,
+				`{"id":"j1","state":"running","progress":60}`,
+				`{"id":"j1","state":"succeeded"}`,
+			}},
+			wantCode: exitOK,
+			wantOut:  []string{"job j1 queued\n", "job j1 running  10%\n", "job j1 running  60%\n", "job j1 succeeded\n"},
+		},
+		{
+			name: "stream failure",
+			srv: &sseServer{events: []string{
+				`{"id":"j1","state":"running","progress":5}`,
+				`{"id":"j1","state":"failed","error":"diverged"}`,
+			}},
+			wantCode: exitFailure,
+			wantOut:  []string{"job j1 failed\n", "  error: diverged\n"},
+		},
+		{
+			name:     "stream cancelled",
+			srv:      &sseServer{events: []string{`{"id":"j1","state":"cancelled"}`}},
+			wantCode: exitFailure,
+			wantOut:  []string{"job j1 cancelled\n"},
+		},
+		{
+			name:     "falls back to polling without a stream",
+			srv:      &sseServer{noStream: true},
+			wantCode: exitOK,
+			wantOut:  []string{"job j1 running  40%\n", "job j1 succeeded\n"},
+			polls:    true,
+		},
+		{
+			name:     "falls back to polling when the stream ends early",
+			srv:      &sseServer{events: []string{`{"id":"j1","state":"running","progress":20}`}},
+			wantCode: exitOK,
+			wantOut:  []string{"job j1 succeeded\n"},
+			polls:    true,
+		},
+		{
+			name:     "json emits one object per update",
+			srv:      &sseServer{events: []string{`{"id":"j1","state":"running","progress":50}`, `{"id":"j1","state":"succeeded"}`}},
+			args:     []string{"--json"},
+			wantCode: exitOK,
+			wantOut:  []string{"{\"id\":\"j1\",\"state\":\"running\",\"progress\":50}\n{\"id\":\"j1\",\"state\":\"succeeded\"}\n"},
+		},
+		{
+			name:     "csv has one header and fixed columns",
+			srv:      &sseServer{events: []string{`{"id":"j1","state":"running","progress":50}`, `{"id":"j1","state":"succeeded","filename":"heat_1.json"}`}},
+			args:     []string{"--output", "csv"},
+			wantCode: exitOK,
+			wantOut:  []string{"id,type,state,progress,filename,error\nj1,,running,50,,\nj1,,succeeded,,heat_1.json,\n"},
+		},
+		{
+			name:     "yaml emits a document per update",
+			srv:      &sseServer{events: []string{`{"id":"j1","state":"running","progress":50}`, `{"id":"j1","state":"succeeded"}`}},
+			args:     []string{"--output", "yaml"},
+			wantCode: exitOK,
+			wantOut:  []string{"---\nid: j1\nstate: running\nprogress: 50\n---\nid: j1\nstate: succeeded\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.srv)
+			defer ts.Close()
+			args := append([]string{"watch", "job", "j1", "--poll", "10ms"}, tt.args...)
+			code, stdout, stderr := runCLI(t, ts.URL, "", args...)
+			if code != tt.wantCode {
+				t.Fatalf("exit %d, want %d; stderr: %s", code, tt.wantCode, stderr)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("stdout missing %q:\n%s", want, stdout)
+				}
+			}
+			if got := tt.srv.polled.Load() > 0; got != tt.polls {
+				t.Errorf("polled = %v, want %v", got, tt.polls)
+			}
+		})
+	}
+}
+
+func TestWatchJobInterrupt(t *testing.T) {
+	for _, cancelJob := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cancel-on-interrupt=%v", cancelJob), func(t *testing.T) {
+			srv := &sseServer{events: []string{`{"id":"j1","state":"running","progress":30}`}, hold: make(chan struct{})}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-srv.hold
+				cancel()
+			}()
+			args := []string{"watch", "job", "j1"}
+			if cancelJob {
+				args = append(args, "--cancel-on-interrupt")
+			}
+			code, _, stderr := runCLIContext(ctx, t, ts.URL, "", args...)
+			if code != exitInterrupted {
+				t.Fatalf("exit %d, want %d; stderr: %s", code, exitInterrupted, stderr)
+			}
+			wantCancels := int32(0)
+			want := "still running"
+			if cancelJob {
+				wantCancels, want = 1, "cancelled"
+			}
+			if got := srv.cancelled.Load(); got != wantCancels {
+				t.Errorf("cancel requests = %d, want %d", got, wantCancels)
+			}
+			if !strings.Contains(stderr, want) {
+				t.Errorf("stderr %q does not mention %q", stderr, want)
+			}
+		})
+	}
+}
+
+func TestWatchQueueOnce(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/stats" {
+			writeJSONResponse(w, http.StatusNotFound, map[string]any{"error": "not found"})
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]any{
+			"queue": map[string]any{"depth": 7, "running": 3, "workers": 4, "busy_workers": 3},
+		})
+	}))
+	defer ts.Close()
+
+	code, stdout, stderr := runCLI(t, ts.URL, "", "watch", "queue", "--once")
+	if code != exitOK {
+		t.Fatalf("exit %d; stderr: %s", code, stderr)
+	}
+	if want := "queued 7  running 3  workers 3/4 busy (75%)"; !strings.Contains(stdout, want) {
+		t.Errorf("stdout %q missing %q", stdout, want)
+	}
+
+	code, stdout, _ = runCLI(t, ts.URL, "", "watch", "queue", "--once", "--json")
+	if code != exitOK || stdout != "{\"depth\":7,\"running\":3,\"workers\":4,\"busy_workers\":3}\n" {
+		t.Errorf("json: exit %d, stdout %q", code, stdout)
+	}
+	for format, want := range map[string]string{
+		"csv":  "depth,running,workers,busy_workers\n7,3,4,3\n",
+		"yaml": "---\ndepth: 7\nrunning: 3\nworkers: 4\nbusy_workers: 3\n",
+	} {
+		code, stdout, _ = runCLI(t, ts.URL, "", "watch", "queue", "--once", "--output", format)
+		if code != exitOK || stdout != want {
+			t.Errorf("%s: exit %d, stdout %q", format, code, stdout)
+		}
+	}
+	code, stdout, _ = runCLI(t, ts.URL, "", "watch", "queue", "--once", "--output", "csv", "--columns", "busy_workers,workers")
+	if code != exitOK || stdout != "busy_workers,workers\n3,4\n" {
+		t.Errorf("csv --columns: exit %d, stdout %q", code, stdout)
+	}
+}
+
+func TestSSEReader(t *testing.T) {
+	in := ": ping\n\nevent: status\nid: 3\ndata: a\ndata: b\n\nretry: 5\n\ndata:c\n\n"
+	r := newSSEReader(strings.NewReader(in))
+	want := []sseEvent{{ID: "3", Event: "status", Data: "a\nb"}, {Data: "c"}}
+	for _, w := range want {
+		ev, err := r.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *ev != w {
+			t.Errorf("got %+v, want %+v", *ev, w)
+		}
+	}
+	if _, err := r.next(); err != io.EOF {
+		t.Errorf("after last event: %v, want io.EOF", err)
+	}
+}
+
+func TestPrintQueueTerminal(t *testing.T) {
+	for _, q := range []queueStats{
+		{Workers: 4, BusyWorkers: 2},
+		{Workers: 4, BusyWorkers: 5}, // more busy than the pool, mid-resize
+		{Workers: 0, BusyWorkers: 1},
+		{Workers: 4, BusyWorkers: -1},
+	} {
+		var buf bytes.Buffer
+		drawQueue(&buf, q, true)
+		if !strings.Contains(buf.String(), fmt.Sprintf("] %d/%d", q.BusyWorkers, q.Workers)) {
+			t.Errorf("%+v: output %q", q, buf.String())
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/safwanhamza/llm-app
+
+go 1.22